@@ -0,0 +1,93 @@
+package tcrsa
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// SharingMode defines how the private exponent of a key is split into key shares.
+type SharingMode uint8
+
+const (
+	// ShamirSharing splits the private exponent with a random polynomial of degree k-1, so any k of the l key
+	// shares can sign. It is the default mode.
+	ShamirSharing SharingMode = iota
+	// AdditiveSharing splits the private exponent into l random summands, so all the key shares are needed to
+	// sign and k must be equal to l. The signature shares are joined by multiplying them, without lagrange
+	// coefficients or factorials of l.
+	AdditiveSharing
+)
+
+// String returns the name of the sharing mode.
+func (mode SharingMode) String() string {
+	switch mode {
+	case ShamirSharing:
+		return "shamir"
+	case AdditiveSharing:
+		return "additive"
+	default:
+		return fmt.Sprintf("SharingMode(%d)", uint8(mode))
+	}
+}
+
+// checkMode checks that a key with the sharing mode and the threshold parameters provided can be created.
+// It returns an error if the mode is unknown, or if it is additive and k is not l.
+func checkMode(mode SharingMode, k, l uint16) error {
+	switch mode {
+	case ShamirSharing:
+		return nil
+	case AdditiveSharing:
+		if k != l {
+			return fmt.Errorf("k should be equal to l in additive sharing mode, but k is %d and l is %d", k, l)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown sharing mode %d", mode)
+	}
+}
+
+// additiveShares splits the secret into l random summands modulo m.
+// It returns the summands, or an error if the random values cannot be generated.
+func additiveShares(secret, m *big.Int, l uint16) ([]*big.Int, error) {
+	values := make([]*big.Int, l)
+	last := new(big.Int).Set(secret)
+	for i := range values[:l-1] {
+		value, err := rand.Int(rand.Reader, m)
+		if err != nil {
+			wipeInts(values...)
+			wipeInts(last)
+			return nil, err
+		}
+		values[i] = value
+		last.Sub(last, value)
+	}
+	values[l-1] = last.Mod(last, m)
+	return values, nil
+}
+
+// additiveJoinCoefficients returns the coefficients to join the shares of all the signers of an additive key.
+// The product of the shares is x^(2*d), so every share has exponent 1, and the exponent of the product of the
+// shares is a, where a and b satisfy 2*a + e*b = 1.
+// It returns an error if the ids are not all the ids of the key.
+func (prepared *PreparedKeyMeta) additiveJoinCoefficients(ids []uint16) (*joinCoefficients, error) {
+	if len(ids) != int(prepared.L) {
+		return nil, fmt.Errorf("additive keys need the %d shares, but there are %d", prepared.L, len(ids))
+	}
+	coefficients := &joinCoefficients{
+		lambdas2: make(map[uint16]*big.Int, len(ids)),
+		tA:       new(big.Int),
+		b:        new(big.Int),
+	}
+	for _, id := range ids {
+		if id < 1 || id > prepared.L {
+			return nil, fmt.Errorf("id should be between 1 and %d, but it is %d", prepared.L, id)
+		}
+		if _, ok := coefficients.lambdas2[id]; ok {
+			return nil, fmt.Errorf("there is more than one share with id %d", id)
+		}
+		coefficients.lambdas2[id] = big.NewInt(1)
+	}
+	new(big.Int).GCD(coefficients.tA, coefficients.b, big.NewInt(2), prepared.e)
+	return coefficients, nil
+}
@@ -0,0 +1,113 @@
+package tcrsa_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+func TestNewKey_additive(t *testing.T) {
+	for _, l := range []uint16{2, 3, keyTestL} {
+		args := fixedKeyArgs(t)
+		args.Mode = tcrsa.AdditiveSharing
+		keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, l, l, args)
+		if err != nil {
+			t.Fatalf("couldn't create keys: %v", err)
+		}
+		if keyMeta.Mode != tcrsa.AdditiveSharing {
+			t.Errorf("key should be in additive sharing mode, but it is in %s mode", keyMeta.Mode)
+		}
+		docs, hashes := batchDocs(t, 2, keyMeta)
+		sigShares := make(tcrsa.SigShareList, len(keyShares))
+		batches := make(tcrsa.BatchSigShareList, len(keyShares))
+		for i, keyShare := range keyShares {
+			if sigShares[i], err = keyShare.Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := sigShares[i].Verify(docs[0], keyMeta); err != nil {
+				t.Errorf("%v", err)
+			}
+			if batches[i], err = keyShare.SignBatch(docs, keyTestHashType, keyMeta); err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+		if _, err := sigShares.BatchVerify(docs[0], keyMeta); err != nil {
+			t.Errorf("%v", err)
+		}
+
+		// The order of the shares does not matter.
+		sigShares[0], sigShares[l-1] = sigShares[l-1], sigShares[0]
+		signature, err := sigShares.Join(docs[0], keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, hashes[0], signature); err != nil {
+			t.Errorf("%v", err)
+		}
+		signatures, err := batches.Join(docs, keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for j, signature := range signatures {
+			if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, hashes[j], signature); err != nil {
+				t.Errorf("signature %d is invalid: %v", j, err)
+			}
+		}
+
+		if _, err := sigShares[1:].Join(docs[0], keyMeta); err == nil {
+			t.Errorf("additive keys should need all the shares to sign")
+		}
+	}
+}
+
+func TestNewKey_additiveInvalid(t *testing.T) {
+	args := fixedKeyArgs(t)
+	args.Mode = tcrsa.AdditiveSharing
+	if _, _, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args); err == nil {
+		t.Errorf("additive keys should need k equal to l")
+	}
+	if _, _, err := tcrsa.NewKeyWithPolicy(keyTestFixedSize, "and(alice, bob)", args); err == nil {
+		t.Errorf("policy keys should not use additive sharing")
+	}
+	args.Mode = tcrsa.AdditiveSharing + 1
+	if _, _, err := tcrsa.NewKey(keyTestFixedSize, keyTestL, keyTestL, args); err == nil {
+		t.Errorf("unknown sharing modes should be rejected")
+	}
+
+	_, keyMeta := fixedKey(t)
+	keyMeta.Mode = tcrsa.AdditiveSharing
+	if _, err := keyMeta.Prepare(); err == nil {
+		t.Errorf("key meta information with k lower than l should not use additive sharing")
+	}
+}
+
+func BenchmarkJoin_additive(b *testing.B) {
+	for _, mode := range []tcrsa.SharingMode{tcrsa.ShamirSharing, tcrsa.AdditiveSharing} {
+		b.Run(mode.String(), func(b *testing.B) {
+			args := fixedKeyArgs(b)
+			args.Mode = mode
+			keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, 3, 3, args)
+			if err != nil {
+				b.Fatalf("couldn't create keys: %v", err)
+			}
+			docs, _ := batchDocs(b, 1, keyMeta)
+			sigShares := make(tcrsa.SigShareList, len(keyShares))
+			for i, keyShare := range keyShares {
+				if sigShares[i], err = keyShare.Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+					b.Fatalf("%v", err)
+				}
+			}
+			prepared, err := keyMeta.Prepare()
+			if err != nil {
+				b.Fatalf("%v", err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := sigShares.Join(docs[0], prepared); err != nil {
+					b.Fatalf("%v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package tcrsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Hash function of the challenges of a subset audit.
+const auditHashType = crypto.SHA256
+
+// Domain separation tag of the challenges of a subset audit.
+const auditTag = "tcrsa/subset-audit/v1"
+
+// AuditReport is the result of AuditSubsets.
+type AuditReport struct {
+	KeyID         KeyID          // Identifier of the key.
+	Subsets       *big.Int       // Number of minimal subsets of the key shares that signed which can join a signature.
+	Tested        int            // Number of subsets tested.
+	Sampled       bool           // True if the tested subsets are a random sample of the subsets.
+	Failures      []AuditFailure // Key shares that failed to sign and subsets that failed to join a valid signature.
+	FailingShares []uint16       // Ids of the key shares that failed to sign or are only in failing subsets, in ascending order.
+}
+
+// AuditFailure is a key share that failed to sign, or a subset of key shares that failed to join a valid signature.
+type AuditFailure struct {
+	Ids   []uint16 // Ids of the key shares, in ascending order.
+	Error string   // Description of the failure.
+}
+
+// OK returns true if every key share signed and every tested subset joined a valid signature.
+func (report *AuditReport) OK() bool {
+	return len(report.Failures) == 0
+}
+
+// String returns a summary of the audit report.
+func (report *AuditReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "key %s: %d of %s subsets tested", report.KeyID, report.Tested, report.Subsets)
+	if report.Sampled {
+		b.WriteString(" (random sample)")
+	}
+	fmt.Fprintf(&b, ", %d failures", len(report.Failures))
+	if len(report.FailingShares) != 0 {
+		fmt.Fprintf(&b, ", failing key shares %v", report.FailingShares)
+	}
+	return b.String()
+}
+
+// AuditSubsets checks that the key shares provided join valid signatures in any minimal subset of them that can
+// sign: any subset of K of them, or for keys with an access structure policy, any subset that satisfies the policy
+// and has no smaller subset that satisfies it, whatever its size. It signs a random challenge with every key
+// share, and joins the signature shares of every minimal subset, checking the signatures with rsa.VerifyPKCS1v15.
+// The subsets are generated one at a time, so all of them can be tested without keeping them in memory. If there
+// are more than maxSubsets subsets and maxSubsets is positive, a uniform random sample of exactly maxSubsets
+// different subsets is tested instead.
+// It returns the report of the audit, or an error if the key meta information is invalid, there are less than K
+// key shares or any id is repeated. Key shares that fail to sign and subsets that fail to join a valid signature
+// are reported as failures.
+func AuditSubsets(keyShares KeyShareList, info MetaInfo, maxSubsets int) (*AuditReport, error) {
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	k := int(meta.K)
+	if len(keyShares) < k {
+		return nil, fmt.Errorf("there should be at least %d key shares, but there are %d", k, len(keyShares))
+	}
+	seen := make(map[uint16]bool, len(keyShares))
+	for _, keyShare := range keyShares {
+		if keyShare == nil {
+			return nil, fmt.Errorf("key share is nil")
+		}
+		if seen[keyShare.Id] {
+			return nil, fmt.Errorf("there is more than one key share with id %d", keyShare.Id)
+		}
+		seen[keyShare.Id] = true
+	}
+
+	digest, challenge, err := auditChallenge(meta)
+	if err != nil {
+		return nil, err
+	}
+	report := &AuditReport{KeyID: append(KeyID{}, meta.keyID...)}
+	passed := make(map[uint16]bool, len(keyShares))
+	failed := make(map[uint16]bool)
+	var sigShares SigShareList
+	for _, keyShare := range keyShares {
+		sigShare, err := keyShare.Sign(challenge, auditHashType, meta)
+		if err != nil {
+			report.Failures = append(report.Failures, AuditFailure{Ids: []uint16{keyShare.Id}, Error: err.Error()})
+			failed[keyShare.Id] = true
+			continue
+		}
+		sigShares = append(sigShares, sigShare)
+	}
+	sort.Slice(sigShares, func(i, j int) bool { return sigShares[i].Id < sigShares[j].Id })
+
+	structure := newAuditStructure(meta, sigShares)
+	report.Subsets = structure.count(structure.root)
+	byId := make(map[uint16]*SigShare, len(sigShares))
+	for _, sigShare := range sigShares {
+		byId[sigShare.Id] = sigShare
+	}
+	test := func(set []uint16) {
+		ids := append([]uint16{}, set...)
+		signers := make(SigShareList, len(ids))
+		for i, id := range ids {
+			signers[i] = byId[id]
+		}
+		report.Tested++
+		if err := joinAndVerify(signers, challenge, digest, meta); err != nil {
+			report.Failures = append(report.Failures, AuditFailure{Ids: ids, Error: err.Error()})
+			for _, id := range ids {
+				failed[id] = true
+			}
+			return
+		}
+		for _, id := range ids {
+			passed[id] = true
+		}
+	}
+
+	if maxSubsets <= 0 || report.Subsets.Cmp(big.NewInt(int64(maxSubsets))) <= 0 {
+		// The subsets are generated one at a time, so they are not kept in memory.
+		structure.each(structure.root, nil, func(set []uint16) bool {
+			test(set)
+			return true
+		})
+	} else {
+		report.Sampled = true
+		chosen := make(map[string]bool, maxSubsets)
+		for len(chosen) < maxSubsets {
+			set, err := structure.sample(structure.root, nil)
+			if err != nil {
+				return nil, err
+			}
+			key := fmt.Sprint(set)
+			if chosen[key] {
+				continue
+			}
+			chosen[key] = true
+			test(set)
+		}
+	}
+
+	for id := range failed {
+		if !passed[id] {
+			report.FailingShares = append(report.FailingShares, id)
+		}
+	}
+	sort.Slice(report.FailingShares, func(i, j int) bool { return report.FailingShares[i] < report.FailingShares[j] })
+	return report, nil
+}
+
+// auditChallenge returns the digest of a new random challenge for a subset audit and the challenge prepared as
+// a document to sign.
+func auditChallenge(meta *PreparedKeyMeta) (digest, challenge []byte, err error) {
+	nonce := make([]byte, ceremonyNonceSize)
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	h := auditHashType.New()
+	writeLengthPrefixed(h, []byte(auditTag))
+	writeLengthPrefixed(h, meta.keyID)
+	writeLengthPrefixed(h, nonce)
+	digest = h.Sum(nil)
+	challenge, err = PrepareDocumentHash(meta.PublicKey.Size(), auditHashType, digest)
+	return
+}
+
+// auditStructure is the access structure of a key restricted to the key shares that signed the challenge of an
+// audit: the policy of the key, or a threshold of K of its key shares. Its minimal authorized sets are the subsets
+// of key shares that an audit tests. As every participant appears once in the structure, the minimal sets of an
+// inner node are the unions of the minimal sets of threshold of its children.
+type auditStructure struct {
+	root    *policyNode
+	signers map[uint16]bool
+	counts  map[*policyNode]*big.Int     // Number of minimal sets by node.
+	tables  map[*policyNode][][]*big.Int // Sampling tables of the inner nodes, computed when they are needed.
+}
+
+// newAuditStructure returns the access structure of the key of the key meta information restricted to the
+// signers of the signature shares.
+func newAuditStructure(meta *PreparedKeyMeta, sigShares SigShareList) *auditStructure {
+	structure := &auditStructure{
+		root:    meta.policy,
+		signers: make(map[uint16]bool, len(sigShares)),
+		counts:  make(map[*policyNode]*big.Int),
+		tables:  make(map[*policyNode][][]*big.Int),
+	}
+	for _, sigShare := range sigShares {
+		structure.signers[sigShare.Id] = true
+	}
+	if structure.root == nil {
+		structure.root = &policyNode{threshold: int(meta.K), children: make([]*policyNode, meta.L)}
+		for i := range structure.root.children {
+			structure.root.children[i] = &policyNode{id: uint16(i + 1)}
+		}
+	}
+	return structure
+}
+
+// count returns the number of minimal authorized sets of the node.
+func (structure *auditStructure) count(node *policyNode) *big.Int {
+	if count, ok := structure.counts[node]; ok {
+		return count
+	}
+	count := new(big.Int)
+	if node.children == nil {
+		if structure.signers[node.id] {
+			count.SetInt64(1)
+		}
+	} else if structure.unitChildren(node) {
+		satisfied := int64(len(structure.satisfiedChildren(node)))
+		if satisfied >= int64(node.threshold) {
+			count.Binomial(satisfied, int64(node.threshold))
+		}
+	} else {
+		count = structure.table(node)[0][node.threshold]
+	}
+	structure.counts[node] = count
+	return count
+}
+
+// unitChildren returns true if every child of the node has at most one minimal set, so the minimal sets of the
+// node are given by the subsets of threshold of its satisfied children.
+func (structure *auditStructure) unitChildren(node *policyNode) bool {
+	for _, child := range node.children {
+		if structure.count(child).Cmp(big.NewInt(1)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfiedChildren returns the children of the node that have minimal sets, from left to right.
+func (structure *auditStructure) satisfiedChildren(node *policyNode) []*policyNode {
+	var satisfied []*policyNode
+	for _, child := range node.children {
+		if structure.count(child).Sign() != 0 {
+			satisfied = append(satisfied, child)
+		}
+	}
+	return satisfied
+}
+
+// table returns the sampling table of an inner node, where table[i][j] is the number of ways to choose j of the
+// satisfied children from the i-th one on, weighted by the number of minimal sets of the chosen children.
+func (structure *auditStructure) table(node *policyNode) [][]*big.Int {
+	if table, ok := structure.tables[node]; ok {
+		return table
+	}
+	satisfied := structure.satisfiedChildren(node)
+	table := make([][]*big.Int, len(satisfied)+1)
+	for i := len(satisfied); i >= 0; i-- {
+		table[i] = make([]*big.Int, node.threshold+1)
+		for j := range table[i] {
+			table[i][j] = new(big.Int)
+			switch {
+			case j == 0:
+				table[i][j].SetInt64(1)
+			case i < len(satisfied):
+				// The i-th child is chosen or not.
+				table[i][j].Mul(structure.count(satisfied[i]), table[i+1][j-1])
+				table[i][j].Add(table[i][j], table[i+1][j])
+			}
+		}
+	}
+	structure.tables[node] = table
+	return table
+}
+
+// each calls yield with every minimal set of the node appended to set, with the ids in ascending order, until
+// yield returns false. The sets are generated one at a time, and yield should copy them to keep them.
+// It returns false if yield returned false.
+func (structure *auditStructure) each(node *policyNode, set []uint16, yield func([]uint16) bool) bool {
+	if node.children == nil {
+		if !structure.signers[node.id] {
+			return true
+		}
+		return yield(append(set, node.id))
+	}
+	satisfied := structure.satisfiedChildren(node)
+	t := node.threshold
+	if len(satisfied) < t {
+		return true
+	}
+	chosen := make([]int, t)
+	for i := range chosen {
+		chosen[i] = i
+	}
+	// The minimal sets of the chosen children are combined one child after the other.
+	var combine func(i int, set []uint16) bool
+	combine = func(i int, set []uint16) bool {
+		if i == t {
+			return yield(set)
+		}
+		return structure.each(satisfied[chosen[i]], set, func(set []uint16) bool {
+			return combine(i+1, set)
+		})
+	}
+	for {
+		if !combine(0, set) {
+			return false
+		}
+		// Next combination of children in lexicographic order.
+		i := t - 1
+		for i >= 0 && chosen[i] == len(satisfied)-t+i {
+			i--
+		}
+		if i < 0 {
+			return true
+		}
+		chosen[i]++
+		for j := i + 1; j < t; j++ {
+			chosen[j] = chosen[j-1] + 1
+		}
+	}
+}
+
+// sample appends a minimal set of the node chosen uniformly at random to set, with the ids in ascending order.
+// The node should have minimal sets.
+// It returns an error if the random set cannot be chosen.
+func (structure *auditStructure) sample(node *policyNode, set []uint16) ([]uint16, error) {
+	if node.children == nil {
+		return append(set, node.id), nil
+	}
+	satisfied := structure.satisfiedChildren(node)
+	t := node.threshold
+	chosen := make([]*policyNode, 0, t)
+	if structure.unitChildren(node) {
+		// Partial Fisher-Yates shuffle of the first t children, as every one of them has a single minimal set.
+		positions := make([]int, len(satisfied))
+		for i := range positions {
+			positions[i] = i
+		}
+		for i := 0; i < t; i++ {
+			j, err := rand.Int(rand.Reader, big.NewInt(int64(len(positions)-i)))
+			if err != nil {
+				return nil, err
+			}
+			swap := i + int(j.Int64())
+			positions[i], positions[swap] = positions[swap], positions[i]
+		}
+		positions = positions[:t]
+		sort.Ints(positions)
+		for _, position := range positions {
+			chosen = append(chosen, satisfied[position])
+		}
+	} else {
+		// Every child is chosen with the probability of the minimal sets that include it.
+		table := structure.table(node)
+		for i, j := 0, t; j > 0; i++ {
+			r, err := rand.Int(rand.Reader, table[i][j])
+			if err != nil {
+				return nil, err
+			}
+			if r.Cmp(table[i+1][j]) >= 0 {
+				chosen = append(chosen, satisfied[i])
+				j--
+			}
+		}
+	}
+	var err error
+	for _, child := range chosen {
+		if set, err = structure.sample(child, set); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// joinAndVerify joins the signature shares of the challenge and verifies the signature with the public key.
+// It returns an error if the signature shares cannot be joined or the signature is invalid.
+func joinAndVerify(signers SigShareList, challenge, digest []byte, meta *PreparedKeyMeta) error {
+	signature, err := signers.Join(challenge, meta)
+	if err != nil {
+		return fmt.Errorf("cannot join the signature shares: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(meta.PublicKey, auditHashType, digest, signature); err != nil {
+		return fmt.Errorf("joined signature is invalid: %v", err)
+	}
+	return nil
+}
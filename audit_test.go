@@ -0,0 +1,122 @@
+package tcrsa_test
+
+import (
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+func TestAuditSubsets(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	report, err := tcrsa.AuditSubsets(keyShares, keyMeta, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// There are 10 subsets of 3 of the 5 key shares.
+	if !report.OK() || report.Tested != 10 || report.Subsets.Int64() != 10 || report.Sampled {
+		t.Errorf("every subset should be tested and valid, but the report is %s", report)
+	}
+
+	report, err = tcrsa.AuditSubsets(keyShares, keyMeta, 4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !report.OK() || report.Tested != 4 || !report.Sampled {
+		t.Errorf("a sample of 4 subsets should be tested, but the report is %s", report)
+	}
+}
+
+func TestAuditSubsets_failures(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	otherShares, _ := fixedKey(t)
+
+	// The key share with id 2 has the value of another key share, and the one with id 4 belongs to another key.
+	corrupted := *keyShares[1]
+	corrupted.Si = keyShares[0].Si
+	audited := tcrsa.KeyShareList{keyShares[0], &corrupted, keyShares[2], otherShares[3], keyShares[4]}
+	report, err := tcrsa.AuditSubsets(audited, keyMeta, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Key share 4 cannot sign, and the 3 subsets of the other 4 key shares with key share 2 fail.
+	if report.OK() || report.Tested != 4 || len(report.Failures) != 4 {
+		t.Fatalf("report should have 4 failures in 4 tested subsets, but it is %s", report)
+	}
+	if len(report.Failures[0].Ids) != 1 || report.Failures[0].Ids[0] != 4 {
+		t.Errorf("first failure should be key share 4, but it is %v", report.Failures[0].Ids)
+	}
+	for _, failure := range report.Failures[1:] {
+		if len(failure.Ids) != 3 || (failure.Ids[0] != 2 && failure.Ids[1] != 2) {
+			t.Errorf("failing subset %v should contain key share 2", failure.Ids)
+		}
+	}
+	if len(report.FailingShares) != 2 || report.FailingShares[0] != 2 || report.FailingShares[1] != 4 {
+		t.Errorf("failing key shares should be 2 and 4, but they are %v", report.FailingShares)
+	}
+
+	if _, err := tcrsa.AuditSubsets(keyShares[:2], keyMeta, 0); err == nil {
+		t.Errorf("audit should need at least K key shares")
+	}
+	if _, err := tcrsa.AuditSubsets(tcrsa.KeyShareList{keyShares[0], keyShares[1], keyShares[1]}, keyMeta, 0); err == nil {
+		t.Errorf("key shares should not be repeated")
+	}
+}
+
+func TestAuditSubsets_policy(t *testing.T) {
+	keyShares, keyMeta, err := tcrsa.NewKeyWithPolicy(keyTestFixedSize, "thresh(2, and(a, b), c, d)", fixedKeyArgs(t))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	report, err := tcrsa.AuditSubsets(keyShares, keyMeta, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// The minimal subsets are {a, b, c}, {a, b, d} and {c, d}.
+	if !report.OK() || report.Tested != 3 || report.Subsets.Int64() != 3 || report.Sampled {
+		t.Errorf("3 subsets should be tested, but the report is %s", report)
+	}
+	for _, failure := range report.Failures {
+		t.Errorf("subset %v failed: %s", failure.Ids, failure.Error)
+	}
+
+	// The sample fills the quota.
+	report, err = tcrsa.AuditSubsets(keyShares, keyMeta, 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !report.OK() || report.Tested != 2 || report.Subsets.Int64() != 3 || !report.Sampled {
+		t.Errorf("a sample of 2 subsets should be tested, but the report is %s", report)
+	}
+
+	// Without a, the only minimal subset is {c, d}.
+	report, err = tcrsa.AuditSubsets(keyShares[1:], keyMeta, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !report.OK() || report.Tested != 1 || report.Subsets.Int64() != 1 {
+		t.Errorf("only one subset should be tested, but the report is %s", report)
+	}
+}
+
+func TestAuditSubsets_nestedPolicy(t *testing.T) {
+	keyShares, keyMeta, err := tcrsa.NewKeyWithPolicy(keyTestFixedSize, "thresh(2, or(a, b), or(c, d, e), f)", fixedKeyArgs(t))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	report, err := tcrsa.AuditSubsets(keyShares, keyMeta, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// 2*3 + 2 + 3 minimal subsets, all of 2 key shares.
+	if !report.OK() || report.Tested != 11 || report.Subsets.Int64() != 11 {
+		t.Errorf("11 subsets should be tested, but the report is %s", report)
+	}
+	for i := 0; i < 5; i++ {
+		report, err := tcrsa.AuditSubsets(keyShares, keyMeta, 10)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if !report.OK() || report.Tested != 10 || !report.Sampled {
+			t.Errorf("a sample of 10 subsets should be tested, but the report is %s", report)
+		}
+	}
+}
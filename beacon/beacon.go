@@ -0,0 +1,185 @@
+// Package beacon implements a threshold randomness beacon on top of tcrsa.
+// RSA full domain hash signatures are unique, so a threshold signature over a round number can not be
+// biased by any subset of the signers. The output of a round is the hash of that signature.
+package beacon
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/niclabs/tcrsa"
+)
+
+// Domain separation tags for the round encoding and the round output.
+const (
+	encodingTag = "tcrsa/beacon/v1/round"
+	outputTag   = "tcrsa/beacon/v1/output"
+)
+
+// Round is the public output of the beacon for a round number.
+type Round struct {
+	Number     uint64          // Round number.
+	Signature  tcrsa.Signature // Threshold signature of the round encoding.
+	Randomness []byte          // Hash of the signature, used as the random value of the round.
+}
+
+// Beacon groups the key meta information and the hash function used to encode rounds.
+type Beacon struct {
+	Meta *tcrsa.KeyMeta // Meta information of the threshold key of the beacon.
+	Hash crypto.Hash    // Hash function used by MGF1 and to derive the round output.
+}
+
+// New creates a beacon for the key meta information provided, using hashType to encode rounds and
+// to derive their outputs.
+// It returns an error if the key meta information is nil or if the hash function is not available.
+func New(meta *tcrsa.KeyMeta, hashType crypto.Hash) (*Beacon, error) {
+	if meta == nil || meta.PublicKey == nil {
+		return nil, fmt.Errorf("key metainfo is nil")
+	}
+	if !hashType.Available() {
+		return nil, fmt.Errorf("hash function %d is not available", hashType)
+	}
+	return &Beacon{
+		Meta: meta,
+		Hash: hashType,
+	}, nil
+}
+
+// Encode returns the full domain hash encoding of a round number for the public key provided.
+// The encoding is the MGF1 output over the full modulus length, with the most significant bits
+// cleared so it is always lower than the modulus.
+func Encode(round uint64, pk *rsa.PublicKey, hashType crypto.Hash) ([]byte, error) {
+	if pk == nil || pk.N == nil {
+		return nil, fmt.Errorf("public key is nil")
+	}
+	if !hashType.Available() {
+		return nil, fmt.Errorf("hash function %d is not available", hashType)
+	}
+	seed := make([]byte, 0, len(encodingTag)+pk.Size()+8)
+	seed = append(seed, encodingTag...)
+	seed = append(seed, pk.N.Bytes()...)
+	seed = appendUint64(seed, round)
+
+	em := mgf1(hashType, seed, pk.Size())
+
+	// Clear the bits over bitlen(n) - 1, so em < n.
+	extraBits := len(em)*8 - (pk.N.BitLen() - 1)
+	for i := 0; extraBits > 0; i++ {
+		if extraBits >= 8 {
+			em[i] = 0
+		} else {
+			em[i] &= 0xff >> uint(extraBits)
+		}
+		extraBits -= 8
+	}
+	if new(big.Int).SetBytes(em).Sign() == 0 {
+		return nil, fmt.Errorf("round %d encodes to zero", round)
+	}
+	return em, nil
+}
+
+// Sign generates the signature share of a node for a round number.
+// It returns the signature share, or an error if the signing process failed.
+func (beacon *Beacon) Sign(keyShare *tcrsa.KeyShare, round uint64) (*tcrsa.SigShare, error) {
+	if keyShare == nil {
+		return nil, fmt.Errorf("key share is nil")
+	}
+	doc, err := Encode(round, beacon.Meta.PublicKey, beacon.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return keyShare.Sign(doc, beacon.Hash, beacon.Meta)
+}
+
+// Combine verifies the signature shares of a round and joins them, deriving the round output.
+// It returns the round, or an error if any signature share is invalid or if the shares could not be joined.
+func (beacon *Beacon) Combine(round uint64, sigShares tcrsa.SigShareList) (*Round, error) {
+	doc, err := Encode(round, beacon.Meta.PublicKey, beacon.Hash)
+	if err != nil {
+		return nil, err
+	}
+	for i, sigShare := range sigShares {
+		if sigShare == nil {
+			return nil, fmt.Errorf("signature share %d is nil", i)
+		}
+		if err := sigShare.Verify(doc, beacon.Meta); err != nil {
+			return nil, err
+		}
+	}
+	signature, err := sigShares.Join(doc, beacon.Meta)
+	if err != nil {
+		return nil, err
+	}
+	r := &Round{
+		Number:     round,
+		Signature:  signature,
+		Randomness: output(beacon.Hash, round, signature),
+	}
+	if err := Verify(beacon.Meta.PublicKey, beacon.Hash, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Verify checks a past round using only the public key of the beacon: the signature must be the
+// unique RSA signature of the round encoding, and the randomness must be the hash of that signature.
+// It returns nil if the round is valid, and an error if it is not.
+func Verify(pk *rsa.PublicKey, hashType crypto.Hash, r *Round) error {
+	if r == nil {
+		return fmt.Errorf("round is nil")
+	}
+	doc, err := Encode(r.Number, pk, hashType)
+	if err != nil {
+		return err
+	}
+	if len(r.Signature) != pk.Size() {
+		return fmt.Errorf("signature of round %d has length %d, but it should be %d", r.Number, len(r.Signature), pk.Size())
+	}
+	sig := new(big.Int).SetBytes(r.Signature)
+	if sig.Cmp(pk.N) >= 0 {
+		return fmt.Errorf("signature of round %d is not lower than the modulus", r.Number)
+	}
+	x := new(big.Int).Exp(sig, big.NewInt(int64(pk.E)), pk.N)
+	if x.Cmp(new(big.Int).SetBytes(doc)) != 0 {
+		return fmt.Errorf("invalid signature for round %d", r.Number)
+	}
+	if !bytes.Equal(output(hashType, r.Number, r.Signature), r.Randomness) {
+		return fmt.Errorf("invalid randomness for round %d", r.Number)
+	}
+	return nil
+}
+
+// output derives the random value of a round from its signature.
+func output(hashType crypto.Hash, round uint64, signature tcrsa.Signature) []byte {
+	h := hashType.New()
+	h.Write([]byte(outputTag))
+	h.Write(appendUint64(nil, round))
+	h.Write(signature)
+	return h.Sum(nil)
+}
+
+// mgf1 is the mask generation function defined in PKCS #1 v2.2, returning length bytes.
+func mgf1(hashType crypto.Hash, seed []byte, length int) []byte {
+	out := make([]byte, 0, length+hashType.Size())
+	var counter uint32
+	for len(out) < length {
+		h := hashType.New()
+		h.Write(seed)
+		var c [4]byte
+		binary.BigEndian.PutUint32(c[:], counter)
+		h.Write(c[:])
+		out = h.Sum(out)
+		counter++
+	}
+	return out[:length]
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
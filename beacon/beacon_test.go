@@ -0,0 +1,80 @@
+package beacon_test
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"github.com/niclabs/tcrsa"
+	"github.com/niclabs/tcrsa/beacon"
+)
+
+const beaconTestK = 3
+const beaconTestL = 5
+const beaconTestSize = 512
+const beaconTestHashType = crypto.SHA256
+const beaconTestRound = 42
+
+func TestBeacon(t *testing.T) {
+	keyShares, keyMeta, err := tcrsa.NewKey(beaconTestSize, beaconTestK, beaconTestL, nil)
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	b, err := beacon.New(keyMeta, beaconTestHashType)
+	if err != nil {
+		t.Fatalf("couldn't create beacon: %v", err)
+	}
+
+	// Two different quorums must produce the same round output.
+	rounds := make([]*beacon.Round, 2)
+	for j, quorum := range [][]int{{0, 1, 2}, {2, 3, 4}} {
+		sigShares := make(tcrsa.SigShareList, len(quorum))
+		for i, idx := range quorum {
+			sigShares[i], err = b.Sign(keyShares[idx], beaconTestRound)
+			if err != nil {
+				t.Fatalf("couldn't sign round: %v", err)
+			}
+		}
+		rounds[j], err = b.Combine(beaconTestRound, sigShares)
+		if err != nil {
+			t.Fatalf("couldn't combine round: %v", err)
+		}
+		if err := beacon.Verify(keyMeta.PublicKey, beaconTestHashType, rounds[j]); err != nil {
+			t.Errorf("round should be valid: %v", err)
+		}
+	}
+	if !bytes.Equal(rounds[0].Randomness, rounds[1].Randomness) {
+		t.Errorf("round output depends on the quorum")
+	}
+
+	forged := *rounds[0]
+	forged.Number++
+	if err := beacon.Verify(keyMeta.PublicKey, beaconTestHashType, &forged); err == nil {
+		t.Errorf("round signature should not be valid for another round number")
+	}
+	forged = *rounds[0]
+	forged.Randomness = append([]byte{}, forged.Randomness...)
+	forged.Randomness[0] ^= 1
+	if err := beacon.Verify(keyMeta.PublicKey, beaconTestHashType, &forged); err == nil {
+		t.Errorf("modified randomness should not be valid")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	_, keyMeta, err := tcrsa.NewKey(beaconTestSize, beaconTestK, beaconTestL, nil)
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	for round := uint64(0); round < 16; round++ {
+		em, err := beacon.Encode(round, keyMeta.PublicKey, beaconTestHashType)
+		if err != nil {
+			t.Fatalf("couldn't encode round %d: %v", round, err)
+		}
+		if len(em) != keyMeta.PublicKey.Size() {
+			t.Errorf("encoding has length %d, but it should be %d", len(em), keyMeta.PublicKey.Size())
+		}
+		if bytes.Compare(em, keyMeta.PublicKey.N.Bytes()) >= 0 {
+			t.Errorf("encoding of round %d is not lower than the modulus", round)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package tcrsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"time"
+)
+
+// Hash function of the acknowledgement challenges of a ceremony.
+const ceremonyHashType = crypto.SHA256
+
+// Domain separation tag of the acknowledgement challenges of a ceremony.
+const ceremonyTag = "tcrsa/ceremony-ack/v1"
+
+// Size in bytes of the random part of an acknowledgement challenge.
+const ceremonyNonceSize = 32
+
+// Ceremony is the acknowledgement protocol of a key dealt by a Dealer. The dealer sends the challenge of the
+// ceremony to every recipient, which signs it with its new key shares using AcknowledgeChallenge and returns the
+// signature shares. The dealer verifies them with Acknowledge and, once all the key shares have been
+// acknowledged, Complete joins them into a test signature and destroys the key shares kept by the dealer.
+// The challenge and the signature shares are plain values, so the protocol can be driven over any transport.
+type Ceremony struct {
+	dealer    *Dealer
+	meta      *PreparedKeyMeta
+	challenge []byte       // Prepared document the recipients sign.
+	digest    []byte       // Hash of the challenge message.
+	acks      SigShareList // Verified acknowledgements, by id - 1.
+	complete  bool
+}
+
+// NewCeremony starts the acknowledgement protocol of the key dealt by the dealer, with a new random challenge.
+// It returns the ceremony, or an error if the dealer has not dealt a key, or has already destroyed its key shares.
+func (dealer *Dealer) NewCeremony() (*Ceremony, error) {
+	if dealer.meta == nil {
+		return nil, fmt.Errorf("dealer has not dealt a key")
+	}
+	if dealer.shares == nil {
+		return nil, fmt.Errorf("dealer has destroyed its key shares")
+	}
+	meta, err := dealer.meta.Prepare()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, ceremonyNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	h := ceremonyHashType.New()
+	writeLengthPrefixed(h, []byte(ceremonyTag))
+	writeLengthPrefixed(h, meta.keyID)
+	writeLengthPrefixed(h, nonce)
+	digest := h.Sum(nil)
+	challenge, err := PrepareDocumentHash(dealer.meta.PublicKey.Size(), ceremonyHashType, digest)
+	if err != nil {
+		return nil, err
+	}
+	return &Ceremony{
+		dealer:    dealer,
+		meta:      meta,
+		challenge: challenge,
+		digest:    digest,
+		acks:      make(SigShareList, dealer.meta.L),
+	}, nil
+}
+
+// Challenge returns the prepared document that the recipients should sign to acknowledge their key shares.
+func (ceremony *Ceremony) Challenge() []byte {
+	return append([]byte{}, ceremony.challenge...)
+}
+
+// AcknowledgeChallenge signs the challenge of a ceremony with the key shares received by a recipient.
+// It returns the signature shares the recipient should send to the dealer, or an error if a key share cannot sign.
+func AcknowledgeChallenge(keyShares KeyShareList, challenge []byte, info MetaInfo) (SigShareList, error) {
+	if len(keyShares) == 0 {
+		return nil, fmt.Errorf("there are no key shares to acknowledge")
+	}
+	return keyShares.Sign(challenge, ceremonyHashType, info)
+}
+
+// Acknowledge verifies the acknowledgements of a recipient, which are the signature shares of the challenge of the
+// ceremony. Keys with proof verification are verified with SigShare.Verify, and keys with MAC verification with
+// a key share of another participant kept by the dealer. The acknowledgements are only recorded if all of them are
+// valid, and a key share cannot be acknowledged twice. The acknowledgements can be addressed by participant name,
+// as the signature shares given to SigShareList.Join.
+// It returns an error if the ceremony is complete or any acknowledgement is invalid.
+func (ceremony *Ceremony) Acknowledge(sigShares SigShareList) error {
+	if ceremony.complete {
+		return fmt.Errorf("ceremony is already complete")
+	}
+	if len(sigShares) == 0 {
+		return fmt.Errorf("there are no acknowledgements")
+	}
+	seen := make(map[uint16]bool, len(sigShares))
+	acks := make(SigShareList, len(sigShares))
+	for i, sigShare := range sigShares {
+		if sigShare == nil {
+			return fmt.Errorf("acknowledgement is nil")
+		}
+		// The acknowledgements of keys with participant names may be addressed by name only.
+		id, err := ceremony.meta.participantId(sigShare.Name, sigShare.Id)
+		if err != nil {
+			return fmt.Errorf("invalid acknowledgement: %w", err)
+		}
+		if id < 1 || id > ceremony.meta.L {
+			return fmt.Errorf("acknowledgement id should be between 1 and %d, but it is %d", ceremony.meta.L, id)
+		}
+		if seen[id] || ceremony.acks[id-1] != nil {
+			return fmt.Errorf("key share with id %d has already been acknowledged", id)
+		}
+		seen[id] = true
+		ack := *sigShare
+		ack.Id = id
+		if err := ceremony.verify(&ack); err != nil {
+			return fmt.Errorf("invalid acknowledgement of key share with id %d: %w", id, err)
+		}
+		acks[i] = &ack
+	}
+	for _, ack := range acks {
+		ceremony.acks[ack.Id-1] = ack
+	}
+	return nil
+}
+
+// verify checks that a signature share is a valid signature of the challenge of the ceremony.
+func (ceremony *Ceremony) verify(sigShare *SigShare) error {
+	if ceremony.meta.Verification != MACVerification {
+		return sigShare.Verify(ceremony.challenge, ceremony.meta)
+	}
+	if ceremony.dealer.shares == nil {
+		return fmt.Errorf("dealer has destroyed its key shares")
+	}
+	// The signature share is verified with the MAC key of the next key share.
+	verifier := ceremony.dealer.shares[int(sigShare.Id)%len(ceremony.dealer.shares)]
+	return verifier.VerifySigShare(sigShare, ceremony.challenge, ceremony.meta)
+}
+
+// Pending returns the ids of the key shares that have not been acknowledged yet, in ascending order.
+func (ceremony *Ceremony) Pending() []uint16 {
+	pending := make([]uint16, 0)
+	for i, ack := range ceremony.acks {
+		if ack == nil {
+			pending = append(pending, uint16(i+1))
+		}
+	}
+	return pending
+}
+
+// Complete finishes the ceremony once every key share has been acknowledged. It joins the acknowledgements into
+// a signature of the challenge, verifies it with the public key, and destroys the key shares kept by the dealer.
+// It returns nil if the ceremony is complete, or an error if there are pending acknowledgements or the test
+// signature is invalid, in which case the dealer keeps its key shares.
+func (ceremony *Ceremony) Complete() error {
+	if ceremony.complete {
+		return nil
+	}
+	if pending := ceremony.Pending(); len(pending) != 0 {
+		return fmt.Errorf("%d key shares have not been acknowledged: %v", len(pending), pending)
+	}
+	signature, err := ceremony.acks.Join(ceremony.challenge, ceremony.meta)
+	if err != nil {
+		return fmt.Errorf("cannot join the acknowledgements: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(ceremony.meta.PublicKey, ceremonyHashType, ceremony.digest, signature); err != nil {
+		return fmt.Errorf("joined acknowledgements are not a valid signature: %v", err)
+	}
+	ceremony.dealer.Destroy()
+	ceremony.dealer.completedAt = time.Now().UTC().Round(0)
+	ceremony.complete = true
+	return nil
+}
+
+// Completed returns true if the ceremony is complete, and the dealer has destroyed its key shares.
+func (ceremony *Ceremony) Completed() bool {
+	return ceremony.complete
+}
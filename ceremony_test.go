@@ -0,0 +1,164 @@
+package tcrsa_test
+
+import (
+	"encoding/json"
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+// dealBundles deals a key to the recipients of the dealer tests and opens their bundles.
+func dealBundles(t *testing.T, verification tcrsa.VerificationMode) (*tcrsa.Dealer, *tcrsa.KeyMeta, []tcrsa.KeyShareList) {
+	recipients, privateKeys := dealerRecipients(t)
+	dealer, err := tcrsa.NewDealer(recipients)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	args := fixedKeyArgs(t)
+	args.Verification = verification
+	keyMeta, bundles, err := dealer.Deal(keyTestFixedSize, 2, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	keyShares := make([]tcrsa.KeyShareList, len(bundles))
+	for i, bundle := range bundles {
+		if keyShares[i], _, err = tcrsa.OpenBundle(bundle, privateKeys[i]); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	return dealer, keyMeta, keyShares
+}
+
+func TestCeremony(t *testing.T) {
+	for _, verification := range []tcrsa.VerificationMode{tcrsa.ProofVerification, tcrsa.MACVerification} {
+		dealer, keyMeta, keyShares := dealBundles(t, verification)
+		ceremony, err := dealer.NewCeremony()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for i, recipientShares := range keyShares {
+			acks, err := tcrsa.AcknowledgeChallenge(recipientShares, ceremony.Challenge(), keyMeta)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			// The acknowledgements can be sent as JSON.
+			encoded, err := json.Marshal(acks)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			var received tcrsa.SigShareList
+			if err := json.Unmarshal(encoded, &received); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if i == len(keyShares)-1 {
+				if err := ceremony.Complete(); err == nil {
+					t.Errorf("%s: ceremony should not be complete with pending acknowledgements", verification)
+				}
+				if pending := ceremony.Pending(); len(pending) != 1 || pending[0] != 3 {
+					t.Errorf("%s: key share 3 should be pending, but the pending key shares are %v", verification, pending)
+				}
+			}
+			if err := ceremony.Acknowledge(received); err != nil {
+				t.Fatalf("%s: %v", verification, err)
+			}
+		}
+		if err := ceremony.Complete(); err != nil {
+			t.Fatalf("%s: %v", verification, err)
+		}
+		if !ceremony.Completed() {
+			t.Errorf("%s: ceremony should be complete", verification)
+		}
+		if _, err := dealer.NewCeremony(); err == nil {
+			t.Errorf("%s: dealer should destroy its key shares when the ceremony is complete", verification)
+		}
+	}
+}
+
+func TestCeremony_invalid(t *testing.T) {
+	dealer, keyMeta, keyShares := dealBundles(t, tcrsa.ProofVerification)
+	ceremony, err := dealer.NewCeremony()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	other, err := dealer.NewCeremony()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	acks, err := tcrsa.AcknowledgeChallenge(keyShares[0], other.Challenge(), keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := ceremony.Acknowledge(acks); err == nil {
+		t.Errorf("acknowledgement of another challenge should be invalid")
+	}
+	acks, err = tcrsa.AcknowledgeChallenge(keyShares[0], ceremony.Challenge(), keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := ceremony.Acknowledge(append(acks, acks[0])); err == nil {
+		t.Errorf("acknowledgement should not be repeated")
+	}
+	if err := ceremony.Acknowledge(acks); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := ceremony.Acknowledge(acks); err == nil {
+		t.Errorf("key share should not be acknowledged twice")
+	}
+	if len(ceremony.Pending()) != 2 {
+		t.Errorf("invalid acknowledgements should not be recorded")
+	}
+}
+
+func TestCeremony_names(t *testing.T) {
+	for _, verification := range []tcrsa.VerificationMode{tcrsa.ProofVerification, tcrsa.MACVerification} {
+		dealer, keyMeta, keyShares := dealBundles(t, verification)
+		ceremony, err := dealer.NewCeremony()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for _, recipientShares := range keyShares {
+			acks, err := tcrsa.AcknowledgeChallenge(recipientShares, ceremony.Challenge(), keyMeta)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			// The acknowledgements are addressed by the name of the participant only.
+			for _, ack := range acks {
+				ack.Id = 0
+			}
+			if err := ceremony.Acknowledge(acks); err != nil {
+				t.Fatalf("%s: %v", verification, err)
+			}
+			if err := ceremony.Acknowledge(acks); err == nil {
+				t.Errorf("%s: key share of %s should not be acknowledged twice", verification, acks[0].Name)
+			}
+		}
+		if pending := ceremony.Pending(); len(pending) != 0 {
+			t.Errorf("%s: key shares %v should be acknowledged", verification, pending)
+		}
+		if err := ceremony.Complete(); err != nil {
+			t.Fatalf("%s: %v", verification, err)
+		}
+	}
+}
+
+func TestCeremony_unknownName(t *testing.T) {
+	dealer, keyMeta, keyShares := dealBundles(t, tcrsa.ProofVerification)
+	ceremony, err := dealer.NewCeremony()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	acks, err := tcrsa.AcknowledgeChallenge(keyShares[0], ceremony.Challenge(), keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	acks[0].Name = "hsm-9"
+	if err := ceremony.Acknowledge(acks); err == nil {
+		t.Errorf("acknowledgement of an unknown participant should be invalid")
+	}
+	acks[0].Name = "hsm-2"
+	if err := ceremony.Acknowledge(acks); err == nil {
+		t.Errorf("acknowledgement with the id of another participant should be invalid")
+	}
+	if len(ceremony.Pending()) != 3 {
+		t.Errorf("invalid acknowledgements should not be recorded")
+	}
+}
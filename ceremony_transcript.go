@@ -0,0 +1,347 @@
+package tcrsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version of the ceremony transcripts, which is also the domain separation tag of their signatures.
+const TranscriptVersion = "tcrsa/ceremony-transcript/v1"
+
+// Domain separation tag of the hashes of the key shares in a ceremony transcript.
+const transcriptShareTag = "tcrsa/transcript-share/v1"
+
+// CeremonyTranscript is the signed record of the dealing of a key by a Dealer, for auditing. It contains the
+// public parameters of the key, the hash of its key meta information and the hashes of the bundles and the key
+// shares distributed to every recipient, but no secret value of the key. It is signed by an operator of the
+// ceremony, whose public key is stored in the transcript.
+type CeremonyTranscript struct {
+	Version      string             // TranscriptVersion.
+	KeyID        KeyID              // Identifier of the key.
+	KeyMetaHash  []byte             // SHA-256 hash of the key meta information in JSON.
+	BitSize      int                // Bit size of the modulus.
+	K            uint16             // Threshold.
+	L            uint16             // Number of key shares.
+	E            int                // Public exponent.
+	ProofParams  ProofParams        // Parameters of the correctness proofs, with the default values set.
+	Epoch        uint32             // Generation of the key shares.
+	Mode         string             // Sharing mode.
+	Verification string             // Verification mode.
+	Policy       string             // Access structure policy, or empty for k-of-l keys.
+	Bundles      []TranscriptBundle // Bundles distributed to the recipients, in the order of the participants.
+	Operators    []string           // Identities of the operators of the ceremony.
+	DealtAt      time.Time          // Time the key was dealt.
+	CompletedAt  *time.Time         // Time the acknowledgement ceremony was completed, or nil if it was not.
+	CreatedAt    time.Time          // Time the transcript was created.
+	SignerKey    []byte             // Public key of the operator that signed the transcript, in PKIX DER form.
+	Signature    []byte             // Signature of the transcript by the operator.
+}
+
+// TranscriptBundle is the record of the bundle of a recipient in a ceremony transcript.
+type TranscriptBundle struct {
+	Name   string            // Name of the recipient.
+	Hash   []byte            // SHA-256 hash of the bundle in JSON.
+	Shares []TranscriptShare // Key shares in the bundle.
+}
+
+// TranscriptShare is the record of a key share in a ceremony transcript.
+type TranscriptShare struct {
+	Id   uint16 // Id of the key share.
+	Hash []byte // SHA-256 hash of the key share, bound to the key identifier, the id and the epoch.
+}
+
+// transcriptBundle returns the record of a bundle with the key shares provided.
+// It returns an error if the bundle cannot be encoded.
+func (bundle *Bundle) transcriptBundle(shares KeyShareList) (TranscriptBundle, error) {
+	hash, err := bundle.hash()
+	if err != nil {
+		return TranscriptBundle{}, err
+	}
+	record := TranscriptBundle{Name: bundle.Name, Hash: hash, Shares: make([]TranscriptShare, len(shares))}
+	for i, keyShare := range shares {
+		record.Shares[i] = TranscriptShare{Id: keyShare.Id, Hash: keyShare.transcriptHash(bundle.KeyID)}
+	}
+	return record, nil
+}
+
+// hash returns the SHA-256 hash of the bundle in JSON.
+// It returns an error if the bundle cannot be encoded.
+func (bundle *Bundle) hash() ([]byte, error) {
+	encoded, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(encoded)
+	return hash[:], nil
+}
+
+// transcriptHash returns the hash of the key share recorded in a ceremony transcript. The value of the key share
+// has as many bits as the modulus, so the hash does not reveal it.
+func (keyShare KeyShare) transcriptHash(keyID KeyID) []byte {
+	var idEpoch [6]byte
+	binary.BigEndian.PutUint16(idEpoch[:2], keyShare.Id)
+	binary.BigEndian.PutUint32(idEpoch[2:], keyShare.Epoch)
+	si := keyShare.Si.Export()
+	defer wipeBytes(si)
+	sha := sha256.New()
+	writeLengthPrefixed(sha, []byte(transcriptShareTag))
+	writeLengthPrefixed(sha, keyID)
+	writeLengthPrefixed(sha, idEpoch[:])
+	writeLengthPrefixed(sha, si)
+	return sha.Sum(nil)
+}
+
+// keyMetaHash returns the SHA-256 hash of the key meta information in JSON.
+// It returns an error if the key meta information cannot be encoded.
+func keyMetaHash(meta *KeyMeta) ([]byte, error) {
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(encoded)
+	return hash[:], nil
+}
+
+// Transcript returns the transcript of the key dealt by the dealer, naming the operators of the ceremony and
+// signed by one of them. The signer should have an Ed25519, ECDSA or RSA key, and RSA keys sign with PKCS #1 v1.5.
+// It returns an error if the dealer has not dealt a key, there are no operators, or the transcript cannot be signed.
+func (dealer *Dealer) Transcript(operators []string, signer crypto.Signer) (*CeremonyTranscript, error) {
+	if dealer.meta == nil {
+		return nil, fmt.Errorf("dealer has not dealt a key")
+	}
+	if len(operators) == 0 {
+		return nil, fmt.Errorf("there should be at least one operator")
+	}
+	for _, operator := range operators {
+		if operator == "" {
+			return nil, fmt.Errorf("operator name is empty")
+		}
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("signer is nil")
+	}
+	meta, err := dealer.meta.prepare()
+	if err != nil {
+		return nil, err
+	}
+	metaHash, err := keyMetaHash(dealer.meta)
+	if err != nil {
+		return nil, err
+	}
+	signerKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer public key: %v", err)
+	}
+	transcript := &CeremonyTranscript{
+		Version:      TranscriptVersion,
+		KeyID:        append(KeyID{}, meta.keyID...),
+		KeyMetaHash:  metaHash,
+		BitSize:      meta.n.BitLen(),
+		K:            meta.K,
+		L:            meta.L,
+		E:            meta.PublicKey.E,
+		ProofParams:  meta.proof,
+		Epoch:        meta.Epoch,
+		Mode:         meta.Mode.String(),
+		Verification: meta.Verification.String(),
+		Policy:       meta.Policy,
+		Bundles:      append([]TranscriptBundle{}, dealer.bundles...),
+		Operators:    append([]string{}, operators...),
+		DealtAt:      dealer.dealtAt,
+		CreatedAt:    time.Now().UTC().Round(0),
+		SignerKey:    signerKey,
+	}
+	if !dealer.completedAt.IsZero() {
+		completedAt := dealer.completedAt
+		transcript.CompletedAt = &completedAt
+	}
+	message, err := transcript.signedMessage()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		transcript.Signature, err = signer.Sign(rand.Reader, message, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(message)
+		transcript.Signature, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot sign the transcript: %v", err)
+	}
+	return transcript, nil
+}
+
+// signedMessage returns the message signed by the operator: the version of the transcript followed by the
+// transcript without its signature in JSON.
+func (transcript CeremonyTranscript) signedMessage() ([]byte, error) {
+	transcript.Signature = nil
+	encoded, err := json.Marshal(transcript)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeLengthPrefixed(&buf, []byte(TranscriptVersion))
+	writeLengthPrefixed(&buf, encoded)
+	return buf.Bytes(), nil
+}
+
+// Verify checks that the transcript is signed by the operator with the public key provided, and that it records
+// the dealing of the key of the key meta information: its identifier, the hash of its key meta information, its
+// parameters and the key shares of every participant.
+// It returns nil if the transcript is valid, or an error if it is not.
+func (transcript *CeremonyTranscript) Verify(info MetaInfo, publicKey crypto.PublicKey) error {
+	if transcript == nil {
+		return fmt.Errorf("transcript is nil")
+	}
+	if transcript.Version != TranscriptVersion {
+		return fmt.Errorf("unknown transcript version %q", transcript.Version)
+	}
+	signerKey, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid signer public key: %v", err)
+	}
+	if !bytes.Equal(signerKey, transcript.SignerKey) {
+		return fmt.Errorf("transcript was signed by another operator")
+	}
+	message, err := transcript.signedMessage()
+	if err != nil {
+		return err
+	}
+	if err := verifyTranscriptSignature(publicKey, message, transcript.Signature); err != nil {
+		return err
+	}
+
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return err
+	}
+	if !transcript.KeyID.Equal(meta.keyID) {
+		return fmt.Errorf("transcript: %w", ErrKeyMismatch)
+	}
+	metaHash, err := keyMetaHash(meta.KeyMeta)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(metaHash, transcript.KeyMetaHash) {
+		return fmt.Errorf("transcript has the hash of another key meta information")
+	}
+	if transcript.BitSize != meta.n.BitLen() || transcript.K != meta.K || transcript.L != meta.L ||
+		transcript.E != meta.PublicKey.E || transcript.ProofParams != meta.proof || transcript.Epoch != meta.Epoch ||
+		transcript.Mode != meta.Mode.String() || transcript.Verification != meta.Verification.String() ||
+		transcript.Policy != meta.Policy {
+		return fmt.Errorf("transcript parameters do not match the key meta information")
+	}
+	if len(transcript.Operators) == 0 {
+		return fmt.Errorf("transcript has no operators")
+	}
+	return transcript.checkBundles(meta)
+}
+
+// checkBundles checks that the transcript has a bundle for every participant of the key, in the same order and
+// with the ids of their key shares, and that every key share of the key is recorded once.
+func (transcript *CeremonyTranscript) checkBundles(meta *PreparedKeyMeta) error {
+	participants := meta.Participants
+	if len(participants) == 0 {
+		return fmt.Errorf("key has no participants, so it was not dealt by a dealer")
+	}
+	if len(transcript.Bundles) != len(participants) {
+		return fmt.Errorf("transcript has %d bundles, but the key has %d participants", len(transcript.Bundles), len(participants))
+	}
+	id := uint16(1)
+	for i, bundle := range transcript.Bundles {
+		participant := participants[i]
+		if bundle.Name != participant.Name || len(bundle.Shares) != int(participant.weight()) {
+			return fmt.Errorf("bundle %d of the transcript does not match participant %q", i, participant.Name)
+		}
+		if len(bundle.Hash) != sha256.Size {
+			return fmt.Errorf("bundle of %q has an invalid hash", bundle.Name)
+		}
+		for _, share := range bundle.Shares {
+			if share.Id != id || len(share.Hash) != sha256.Size {
+				return fmt.Errorf("bundle of %q has an invalid key share record", bundle.Name)
+			}
+			id++
+		}
+	}
+	return nil
+}
+
+// VerifyBundle checks that the bundle is the one recorded in the transcript for its recipient. The transcript
+// should be verified first with Verify.
+// It returns nil if the bundle was recorded, or an error if it was not.
+func (transcript *CeremonyTranscript) VerifyBundle(bundle *Bundle) error {
+	if bundle == nil {
+		return fmt.Errorf("bundle is nil")
+	}
+	if !bundle.KeyID.Equal(transcript.KeyID) {
+		return fmt.Errorf("bundle: %w", ErrKeyMismatch)
+	}
+	hash, err := bundle.hash()
+	if err != nil {
+		return err
+	}
+	for _, record := range transcript.Bundles {
+		if record.Name == bundle.Name {
+			if !bytes.Equal(record.Hash, hash) {
+				return fmt.Errorf("bundle of %q is not the one recorded in the transcript", bundle.Name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("transcript has no bundle for %q", bundle.Name)
+}
+
+// VerifyKeyShare checks that the key share is the one recorded in the transcript with its id. The transcript
+// should be verified first with Verify.
+// It returns nil if the key share was recorded, or an error if it was not.
+func (transcript *CeremonyTranscript) VerifyKeyShare(keyShare *KeyShare) error {
+	if keyShare == nil {
+		return fmt.Errorf("key share is nil")
+	}
+	if !keyShare.KeyID.Equal(transcript.KeyID) {
+		return fmt.Errorf("key share: %w", ErrKeyMismatch)
+	}
+	for _, bundle := range transcript.Bundles {
+		for _, share := range bundle.Shares {
+			if share.Id == keyShare.Id {
+				if bundle.Name != keyShare.Name || !bytes.Equal(share.Hash, keyShare.transcriptHash(transcript.KeyID)) {
+					return fmt.Errorf("key share with id %d is not the one recorded in the transcript", keyShare.Id)
+				}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("transcript has no key share with id %d", keyShare.Id)
+}
+
+// verifyTranscriptSignature verifies the signature of a transcript message with an Ed25519, ECDSA or RSA public
+// key.
+// It returns nil if the signature is valid, or an error if it is not or the public key is not supported.
+func verifyTranscriptSignature(publicKey crypto.PublicKey, message, signature []byte) error {
+	digest := sha256.Sum256(message)
+	valid := false
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, message, signature)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return fmt.Errorf("unsupported signer public key type %T", publicKey)
+	}
+	if !valid {
+		return fmt.Errorf("invalid transcript signature")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package tcrsa_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+func TestDealer_Transcript(t *testing.T) {
+	recipients, privateKeys := dealerRecipients(t)
+	dealer, err := tcrsa.NewDealer(recipients)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	keyMeta, bundles, err := dealer.Deal(keyTestFixedSize, 2, fixedKeyArgs(t))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ceremony, err := dealer.NewCeremony()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var keyShares tcrsa.KeyShareList
+	for i, bundle := range bundles {
+		recipientShares, _, err := tcrsa.OpenBundle(bundle, privateKeys[i])
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		acks, err := tcrsa.AcknowledgeChallenge(recipientShares, ceremony.Challenge(), keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := ceremony.Acknowledge(acks); err != nil {
+			t.Fatalf("%v", err)
+		}
+		keyShares = append(keyShares, recipientShares...)
+	}
+	if err := ceremony.Complete(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	transcript, err := dealer.Transcript([]string{"alice@example.org", "bob@example.org"}, privateKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if transcript.CompletedAt == nil {
+		t.Errorf("transcript should record the completion of the ceremony")
+	}
+
+	// Auditors receive the transcript and the key meta information as JSON.
+	encoded, err := json.Marshal(transcript)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, keyShare := range keyShares {
+		if bytes.Contains(encoded, []byte(base64.StdEncoding.EncodeToString(keyShare.Si.Export()))) {
+			t.Errorf("transcript should not contain the key shares")
+		}
+	}
+	var received tcrsa.CeremonyTranscript
+	if err := json.Unmarshal(encoded, &received); err != nil {
+		t.Fatalf("%v", err)
+	}
+	encodedMeta, err := json.Marshal(keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var receivedMeta tcrsa.KeyMeta
+	if err := json.Unmarshal(encodedMeta, &receivedMeta); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := received.Verify(&receivedMeta, publicKey); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, bundle := range bundles {
+		if err := received.VerifyBundle(bundle); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+	for _, keyShare := range keyShares {
+		if err := received.VerifyKeyShare(keyShare); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := received.Verify(keyMeta, otherPublicKey); err == nil {
+		t.Errorf("transcript should not be verified with the key of another operator")
+	}
+	otherShares, otherMeta := fixedKey(t)
+	if err := received.Verify(otherMeta, publicKey); err == nil {
+		t.Errorf("transcript should not be verified with another key")
+	}
+	if err := received.VerifyKeyShare(otherShares[0]); err == nil {
+		t.Errorf("key share of another key should not be recorded")
+	}
+	modified := received
+	modified.K = 3
+	if err := modified.Verify(keyMeta, publicKey); err == nil {
+		t.Errorf("modified transcript should be invalid")
+	}
+	if err := received.VerifyBundle(&tcrsa.Bundle{Name: bundles[0].Name, KeyID: bundles[0].KeyID}); err == nil {
+		t.Errorf("bundle that was not dealt should be invalid")
+	}
+}
+
+func TestDealer_TranscriptECDSA(t *testing.T) {
+	recipients, _ := dealerRecipients(t)
+	dealer, err := tcrsa.NewDealer(recipients)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := dealer.Transcript([]string{"alice@example.org"}, privateKey); err == nil {
+		t.Errorf("transcript should need a dealt key")
+	}
+	keyMeta, _, err := dealer.Deal(keyTestFixedSize, 2, fixedKeyArgs(t))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := dealer.Transcript(nil, privateKey); err == nil {
+		t.Errorf("transcript should need operators")
+	}
+	transcript, err := dealer.Transcript([]string{"alice@example.org"}, privateKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if transcript.CompletedAt != nil {
+		t.Errorf("transcript should not record a ceremony that was not completed")
+	}
+	if err := transcript.Verify(keyMeta, &privateKey.PublicKey); err != nil {
+		t.Errorf("%v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package tcrsa_test
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"github.com/niclabs/tcrsa"
+	"math/rand"
+	"testing"
+)
+
+const committeeTestL = 60
+
+// committeeSigShares signs a document with a random subset of k key shares.
+func committeeSigShares(tb testing.TB, keyShares tcrsa.KeyShareList, keyMeta *tcrsa.KeyMeta, doc []byte, rnd *rand.Rand) tcrsa.SigShareList {
+	sigShares := make(tcrsa.SigShareList, keyMeta.K)
+	for i, idx := range rnd.Perm(len(keyShares))[:keyMeta.K] {
+		var err error
+		if sigShares[i], err = keyShares[idx].Sign(doc, keyTestHashType, keyMeta); err != nil {
+			tb.Fatalf("%v", err)
+		}
+	}
+	return sigShares
+}
+
+func TestJoin_largeCommittee(t *testing.T) {
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, committeeTestL/2+1, committeeTestL, fixedKeyArgs(t))
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	prepared, err := keyMeta.Prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	docs, hashes := batchDocs(t, 1, keyMeta)
+	rnd := rand.New(rand.NewSource(1))
+	for round := 0; round < 3; round++ {
+		sigShares := committeeSigShares(t, keyShares, keyMeta, docs[0], rnd)
+		// The second join of the same subset uses the cached coefficients.
+		for _, info := range []tcrsa.MetaInfo{keyMeta, prepared, prepared} {
+			signature, err := sigShares.Join(docs[0], info)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, keyTestHashType, hashes[0], signature); err != nil {
+				t.Errorf("%v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkNewKey_largeCommittee(b *testing.B) {
+	for _, l := range []uint16{10, 100, 1000} {
+		b.Run(fmt.Sprintf("L=%d", l), func(b *testing.B) {
+			args := fixedKeyArgs(b)
+			for i := 0; i < b.N; i++ {
+				if _, _, err := tcrsa.NewKey(keyTestFixedSize, l/2+1, l, args); err != nil {
+					b.Fatalf("%v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkJoin_largeCommittee(b *testing.B) {
+	for _, l := range []uint16{10, 100, 1000} {
+		keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, l/2+1, l, fixedKeyArgs(b))
+		if err != nil {
+			b.Fatalf("couldn't create keys: %v", err)
+		}
+		docs, _ := batchDocs(b, 1, keyMeta)
+		sigShares := committeeSigShares(b, keyShares, keyMeta, docs[0], rand.New(rand.NewSource(1)))
+		prepared, err := keyMeta.Prepare()
+		if err != nil {
+			b.Fatalf("%v", err)
+		}
+		b.Run(fmt.Sprintf("L=%d/uncached", l), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := sigShares.Join(docs[0], keyMeta); err != nil {
+					b.Fatalf("%v", err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("L=%d/cached", l), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := sigShares.Join(docs[0], prepared); err != nil {
+					b.Fatalf("%v", err)
+				}
+			}
+		})
+	}
+}
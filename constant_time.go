@@ -0,0 +1,222 @@
+package tcrsa
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// Window size in bits of the constant-time exponentiation.
+const ctExpWindow = 4
+
+// ctModulus is an odd modulus prepared for constant-time Montgomery arithmetic over fixed-width numbers.
+// The numbers are slices of 64 bit limbs in little-endian order, all of them with as many limbs as the
+// modulus, and their values and the values of the exponents do not change the sequence of operations
+// and memory accesses performed with them. The modulus itself is not secret.
+type ctModulus struct {
+	n     *big.Int // Modulus.
+	m     []uint64 // Modulus limbs.
+	m0inv uint64   // -m^-1 mod 2^64
+	rr    []uint64 // R^2 mod m, with R = 2^(64*len(m)).
+	one   []uint64 // R mod m, the Montgomery form of 1.
+}
+
+// newCtModulus prepares n for constant-time Montgomery arithmetic.
+// It returns an error if n is not odd and greater than one.
+func newCtModulus(n *big.Int) (*ctModulus, error) {
+	if n.Sign() <= 0 || n.Bit(0) == 0 || n.BitLen() < 2 {
+		return nil, fmt.Errorf("modulus should be odd and greater than one")
+	}
+	limbs := ctLimbsLen(n.BitLen())
+	mod := &ctModulus{
+		n: new(big.Int).Set(n),
+		m: ctLimbsFromBig(n, limbs),
+	}
+	// Newton iteration: each step doubles the number of correct low bits of the inverse of m[0].
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - mod.m[0]*inv
+	}
+	mod.m0inv = -inv
+	r := new(big.Int).Lsh(big.NewInt(1), uint(64*limbs))
+	mod.one = ctLimbsFromBig(new(big.Int).Mod(r, n), limbs)
+	r.Mul(r, r).Mod(r, n)
+	mod.rr = ctLimbsFromBig(r, limbs)
+	return mod, nil
+}
+
+// ctLimbsLen returns the number of 64 bit limbs needed to store a number of bitLen bits.
+func ctLimbsLen(bitLen int) int {
+	return (bitLen + 63) / 64
+}
+
+// ctLimbsFromBytes returns the big-endian number b as a fixed-width number of the given number of limbs.
+// It returns an error if b does not fit in them.
+func ctLimbsFromBytes(b []byte, limbs int) ([]uint64, error) {
+	if len(b) > 8*limbs {
+		return nil, fmt.Errorf("value has %d bytes, but it should have at most %d", len(b), 8*limbs)
+	}
+	z := make([]uint64, limbs)
+	for i, v := range b {
+		k := len(b) - 1 - i
+		z[k/8] |= uint64(v) << uint(8*(k%8))
+	}
+	return z, nil
+}
+
+// ctLimbsFromBig returns the non negative public value x as a fixed-width number of the given number of limbs.
+// The value is truncated if it does not fit in them.
+func ctLimbsFromBig(x *big.Int, limbs int) []uint64 {
+	b := x.Bytes()
+	if len(b) > 8*limbs {
+		b = b[len(b)-8*limbs:]
+	}
+	z, _ := ctLimbsFromBytes(b, limbs)
+	return z
+}
+
+// ctLimbsToBig returns the fixed-width number x as a big.Int. The result is no longer handled in
+// constant time, so it should only be used with values that are going to be public.
+func ctLimbsToBig(x []uint64) *big.Int {
+	b := make([]byte, 8*len(x))
+	for i, v := range x {
+		for k := 0; k < 8; k++ {
+			b[len(b)-1-8*i-k] = byte(v >> uint(8*k))
+		}
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+// ctWipe sets all the limbs of x to zero.
+func ctWipe(x []uint64) {
+	for i := range x {
+		x[i] = 0
+	}
+}
+
+// ctSelect sets z to x if mask is all ones, or to y if it is zero.
+func ctSelect(z, x, y []uint64, mask uint64) {
+	for i := range z {
+		z[i] = x[i]&mask | y[i]&^mask
+	}
+}
+
+// ctEqMask returns all ones if x == y, or zero otherwise.
+func ctEqMask(x, y uint64) uint64 {
+	// x^y is zero if and only if x == y, and then subtracting one borrows.
+	_, borrow := bits.Sub64(x^y, 1, 0)
+	return -borrow
+}
+
+// montMul sets z to x*y*R^-1 mod m, with x and y lower than m. t is a scratch space of 2*len(m)+2 limbs.
+// z may alias x or y.
+func (mod *ctModulus) montMul(z, x, y, t []uint64) {
+	m := mod.m
+	n := len(m)
+	acc := t[:n+2]
+	ctWipe(acc)
+	// Coarsely integrated operand scanning (CIOS).
+	for i := 0; i < n; i++ {
+		// acc += x[i] * y
+		var carry uint64
+		for j := 0; j < n; j++ {
+			hi, lo := bits.Mul64(x[i], y[j])
+			var c uint64
+			lo, c = bits.Add64(lo, acc[j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			acc[j], carry = lo, hi
+		}
+		var c uint64
+		acc[n], c = bits.Add64(acc[n], carry, 0)
+		acc[n+1] += c
+
+		// acc = (acc + q*m) / 2^64, with q chosen to make the lowest limb zero.
+		q := acc[0] * mod.m0inv
+		hi, lo := bits.Mul64(q, m[0])
+		_, c = bits.Add64(lo, acc[0], 0)
+		carry = hi + c
+		for j := 1; j < n; j++ {
+			hi, lo = bits.Mul64(q, m[j])
+			lo, c = bits.Add64(lo, acc[j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			acc[j-1], carry = lo, hi
+		}
+		acc[n-1], c = bits.Add64(acc[n], carry, 0)
+		acc[n] = acc[n+1] + c
+		acc[n+1] = 0
+	}
+	// acc < 2m, so one masked subtraction of m leaves it lower than m.
+	diff := t[n+2 : 2*n+2]
+	var borrow uint64
+	for j := 0; j < n; j++ {
+		diff[j], borrow = bits.Sub64(acc[j], m[j], borrow)
+	}
+	_, borrow = bits.Sub64(acc[n], 0, borrow)
+	ctSelect(z, acc[:n], diff, -borrow)
+}
+
+// exp returns x^e mod m, where x is a public base and e is a secret fixed-width exponent of any number of limbs.
+// Every window of the exponent, including the leading zero ones, is processed with the same squarings, a
+// constant-time table lookup and a multiplication.
+func (mod *ctModulus) exp(x *big.Int, e []uint64) *big.Int {
+	n := len(mod.m)
+	t := make([]uint64, 2*n+2)
+	base := ctLimbsFromBig(new(big.Int).Mod(x, mod.n), n)
+
+	// table[d] = x^d in Montgomery form.
+	table := make([][]uint64, 1<<ctExpWindow)
+	table[0] = append([]uint64{}, mod.one...)
+	table[1] = make([]uint64, n)
+	mod.montMul(table[1], base, mod.rr, t)
+	for d := 2; d < len(table); d++ {
+		table[d] = make([]uint64, n)
+		mod.montMul(table[d], table[d-1], table[1], t)
+	}
+
+	result := append([]uint64{}, mod.one...)
+	entry := make([]uint64, n)
+	for j := 64*len(e)/ctExpWindow - 1; j >= 0; j-- {
+		for k := 0; k < ctExpWindow; k++ {
+			mod.montMul(result, result, result, t)
+		}
+		bit := j * ctExpWindow
+		d := (e[bit/64] >> uint(bit%64)) & (1<<ctExpWindow - 1)
+		for i := range table {
+			ctSelect(entry, table[i], entry, ctEqMask(uint64(i), d))
+		}
+		mod.montMul(result, result, entry, t)
+	}
+
+	// Leave the Montgomery form multiplying by 1.
+	ctWipe(entry)
+	entry[0] = 1
+	mod.montMul(result, result, entry, t)
+	return ctLimbsToBig(result)
+}
+
+// ctMulAdd returns a*b + c as a fixed-width number of the given number of limbs, which should be enough to
+// store the result. The operations performed depend only on the number of limbs of the operands.
+func ctMulAdd(a, b, c []uint64, limbs int) []uint64 {
+	z := make([]uint64, limbs)
+	copy(z, c)
+	for i := range a {
+		var carry uint64
+		for j := range b {
+			hi, lo := bits.Mul64(a[i], b[j])
+			var cc uint64
+			lo, cc = bits.Add64(lo, z[i+j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, carry, 0)
+			hi += cc
+			z[i+j], carry = lo, hi
+		}
+		for k := i + len(b); k < limbs; k++ {
+			z[k], carry = bits.Add64(z[k], carry, 0)
+		}
+	}
+	return z
+}
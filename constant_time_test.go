@@ -0,0 +1,247 @@
+package tcrsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"math/big"
+	mathrand "math/rand"
+	"testing"
+)
+
+// ctTestModuli returns odd moduli of several sizes, including ones with all their limbs set.
+func ctTestModuli(t *testing.T) []*big.Int {
+	moduli := []*big.Int{big.NewInt(3), new(big.Int).SetUint64(1<<64 - 1)}
+	for _, bits := range []int{64, 127, 512, 1024, 2048} {
+		p, err := rand.Prime(rand.Reader, bits/2+1)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		q, err := rand.Prime(rand.Reader, bits/2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		moduli = append(moduli, new(big.Int).Mul(p, q))
+	}
+	allOnes := new(big.Int).Lsh(big.NewInt(1), 1024)
+	return append(moduli, allOnes.Sub(allOnes, big.NewInt(1)))
+}
+
+func TestCtModulus_exp(t *testing.T) {
+	rnd := mathrand.New(mathrand.NewSource(1))
+	for _, n := range ctTestModuli(t) {
+		mod, err := newCtModulus(n)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		limbs := ctLimbsLen(n.BitLen())
+		nMinusOne := new(big.Int).Sub(n, big.NewInt(1))
+		bases := []*big.Int{big.NewInt(0), big.NewInt(1), nMinusOne, new(big.Int).Add(n, big.NewInt(2))}
+		exps := []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(2), nMinusOne}
+		for i := 0; i < 4; i++ {
+			bases = append(bases, new(big.Int).Rand(rnd, n))
+			exps = append(exps, new(big.Int).Rand(rnd, new(big.Int).Lsh(n, 1)))
+		}
+		for _, x := range bases {
+			for _, e := range exps {
+				expected := new(big.Int).Exp(x, e, n)
+				if got := mod.exp(x, ctLimbsFromBig(e, limbs+1)); got.Cmp(expected) != 0 {
+					t.Errorf("%v^%v mod %v should be %v, but it is %v", x, e, n, expected, got)
+				}
+			}
+		}
+	}
+}
+
+func TestNewCtModulus_even(t *testing.T) {
+	for _, n := range []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(-3), big.NewInt(1 << 20)} {
+		if _, err := newCtModulus(n); err == nil {
+			t.Errorf("modulus %v should not be accepted", n)
+		}
+	}
+}
+
+func TestCtMulAdd(t *testing.T) {
+	rnd := mathrand.New(mathrand.NewSource(2))
+	max := new(big.Int).Lsh(big.NewInt(1), 64*8)
+	allOnes := new(big.Int).Sub(max, big.NewInt(1))
+	for i := 0; i < 50; i++ {
+		a, b, c := new(big.Int).Rand(rnd, max), new(big.Int).Rand(rnd, max), new(big.Int).Rand(rnd, max)
+		if i == 0 {
+			a, b, c = allOnes, allOnes, allOnes
+		}
+		expected := new(big.Int).Mul(a, b)
+		expected.Add(expected, c)
+		got := ctLimbsToBig(ctMulAdd(ctLimbsFromBig(a, 8), ctLimbsFromBig(b, 8), ctLimbsFromBig(c, 8), 17))
+		if got.Cmp(expected) != 0 {
+			t.Errorf("%v*%v+%v should be %v, but it is %v", a, b, c, expected, got)
+		}
+	}
+}
+
+func TestCtLimbsFromBytes(t *testing.T) {
+	b := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	z, err := ctLimbsFromBytes(b, 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ctLimbsToBig(z).Cmp(new(big.Int).SetBytes(b)) != 0 || z[1] != 1 || z[0] != 0x0203040506070809 {
+		t.Errorf("wrong limbs %x", z)
+	}
+	if _, err := ctLimbsFromBytes(b, 1); err == nil {
+		t.Errorf("value larger than the limbs should not be accepted")
+	}
+}
+
+// TestKeyShare_Sign_constantTime checks that the shares and proofs computed with the constant-time
+// arithmetic are the ones computed with big.Int.
+func TestKeyShare_Sign_constantTime(t *testing.T) {
+	keyShares, keyMeta, err := NewKey(512, 3, 5, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	meta, err := keyMeta.prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	doc := make([]byte, keyMeta.PublicKey.Size())
+	if _, err := rand.Read(doc[1:]); err != nil {
+		t.Fatalf("%v", err)
+	}
+	x, _ := meta.adjustDocument(doc)
+	for _, keyShare := range keyShares {
+		si := new(big.Int).SetBytes(keyShare.Si)
+		sigShare, err := keyShare.Sign(doc, crypto.SHA256, keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		expected := new(big.Int).Exp(x, new(big.Int).Lsh(si, 1), meta.n)
+		if new(big.Int).SetBytes(sigShare.Xi).Cmp(expected) != 0 {
+			t.Errorf("share %d: xi differs from the big.Int value", keyShare.Id)
+		}
+
+		siLimbs, _, err := keyShare.secretExponents(meta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		c := new(big.Int).Sub(meta.n, big.NewInt(1))
+		rBits := meta.n.BitLen() + 512
+		r, err := randInt(rBits)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		z := new(big.Int).Mul(c, si)
+		z.Add(z, r)
+		if proofResponse(c, siLimbs, ctLimbsFromBig(r, ctLimbsLen(rBits))).Cmp(z) != 0 {
+			t.Errorf("share %d: z differs from the big.Int value", keyShare.Id)
+		}
+	}
+}
+
+// TestKeyShare_Sign_constantTimeNonce checks that the powers of the proof nonces are computed with the
+// constant-time exponentiation. The nonces are fixed-width numbers, which only the constant-time operations
+// accept, and signing must not use the variable-time fixed-base table of V: the shares signed with a broken
+// table are still valid.
+func TestKeyShare_Sign_constantTimeNonce(t *testing.T) {
+	keyShares, keyMeta, err := NewKey(512, 2, 3, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	prepared, err := keyMeta.Prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Every power of the broken table is 1.
+	prepared.vTable = newFixedBaseTable(big.NewInt(1), prepared.n, prepared.vTable.maxBits)
+	doc := make([]byte, keyMeta.PublicKey.Size())
+	if _, err := rand.Read(doc[1:]); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	sigShare, err := keyShares[0].Sign(doc, crypto.SHA256, prepared)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := sigShare.Verify(doc, keyMeta); err != nil {
+		t.Errorf("share proof should not use the fixed-base table: %v", err)
+	}
+	batch, err := keyShares[0].SignBatch([][]byte{doc}, crypto.SHA256, prepared)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := batch.Verify([][]byte{doc}, keyMeta); err != nil {
+		t.Errorf("batch proof should not use the fixed-base table: %v", err)
+	}
+}
+
+// TestSubShare_Commit_constantTimeNonce checks that the commitments of the custodians of a sub-shared key share
+// are not computed with the variable-time fixed-base table of V either.
+func TestSubShare_Commit_constantTimeNonce(t *testing.T) {
+	keyShares, keyMeta, err := NewKey(512, 2, 3, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	prepared, err := keyMeta.Prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	prepared.vTable = newFixedBaseTable(big.NewInt(1), prepared.n, prepared.vTable.maxBits)
+	doc := make([]byte, keyMeta.PublicKey.Size())
+	if _, err := rand.Read(doc[1:]); err != nil {
+		t.Fatalf("%v", err)
+	}
+	subShares, err := keyShares[0].SubShare(2, 2, prepared)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	quorum := []uint16{1, 2}
+	hashes := make([]*SubCommitmentHash, len(subShares))
+	nonces := make([]*SubNonce, len(subShares))
+	for i, subShare := range subShares {
+		if hashes[i], nonces[i], err = subShare.Commit(doc, quorum, prepared); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	commitments := make([]*SubCommitment, len(subShares))
+	for i, subShare := range subShares {
+		if commitments[i], err = subShare.Reveal(nonces[i], hashes); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	responses := make([]*SubResponse, len(subShares))
+	for i, subShare := range subShares {
+		if responses[i], err = subShare.Respond(nonces[i], commitments, doc, keyMeta); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if _, err := JoinSubShares(hashes, commitments, responses, doc, keyMeta); err != nil {
+		t.Errorf("sub-share commitments should not use the fixed-base table: %v", err)
+	}
+}
+
+func BenchmarkCtModulus_exp(b *testing.B) {
+	keyShares, keyMeta, err := NewKey(512, 3, 5, nil)
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	meta, err := keyMeta.prepare()
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	si, exp, err := keyShares[0].secretExponents(meta)
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	x := new(big.Int).Sub(meta.n, big.NewInt(2))
+	b.Run("constant-time", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			meta.ctN.exp(x, exp)
+		}
+	})
+	b.Run("big.Int", func(b *testing.B) {
+		e := ctLimbsToBig(si)
+		e.Lsh(e, 1)
+		for i := 0; i < b.N; i++ {
+			new(big.Int).Exp(x, e, meta.n)
+		}
+	})
+}
@@ -0,0 +1,427 @@
+package tcrsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Schemes used to encrypt the key of a bundle to its recipient.
+const (
+	// BundleX25519 derives the key of the bundle with HKDF-SHA256 from an X25519 exchange between an ephemeral
+	// key and the key of the recipient.
+	BundleX25519 = "x25519-hkdf-sha256"
+	// BundleRSAOAEP encrypts a random key of the bundle to the key of the recipient with RSA-OAEP and SHA-256.
+	BundleRSAOAEP = "rsa-oaep-sha256"
+)
+
+// Domain separation tag of the share bundles.
+const bundleTag = "tcrsa/bundle/v1"
+
+// Recipient is a participant of a key dealing, with the public key its key shares are encrypted to. The public
+// key is an *ecdh.PublicKey of the X25519 curve or an *rsa.PublicKey.
+type Recipient struct {
+	Name      string
+	PublicKey crypto.PublicKey
+}
+
+// Bundle stores the key shares of a participant and the key meta information, encrypted with AES-256-GCM to the
+// public key of the participant. The name of the participant, the key identifier, the scheme and the encapsulated
+// key are authenticated with the ciphertext, so the bundle cannot be opened if any of them is modified.
+type Bundle struct {
+	Name            string // Name of the participant.
+	KeyID           KeyID  // Identifier of the key.
+	Scheme          string // Scheme used to encrypt the key of the bundle, BundleX25519 or BundleRSAOAEP.
+	EncapsulatedKey []byte // Ephemeral X25519 public key, or the key of the bundle encrypted with RSA-OAEP.
+	Nonce           []byte // Nonce of the AES-GCM encryption.
+	Ciphertext      []byte // Key shares and key meta information encrypted with AES-GCM.
+}
+
+// Dealer creates a key and the encrypted bundles of key shares of its recipients. It keeps the key shares until
+// Destroy is called, so they can be used to check that the recipients received them.
+type Dealer struct {
+	recipients  []Recipient
+	meta        *KeyMeta
+	shares      KeyShareList
+	bundles     []TranscriptBundle // Hashes of the dealt bundles, for the transcript.
+	dealtAt     time.Time          // Time the key was dealt.
+	completedAt time.Time          // Time the acknowledgement ceremony was completed, or zero.
+}
+
+// bundlePayload is the plaintext of a bundle. The values of the key shares are stored in standard Base64, which
+// is the format accepted by SecretBytes.UnmarshalJSON, so the payload can be decoded as a bundleContent.
+type bundlePayload struct {
+	KeyMeta   *KeyMeta
+	KeyShares []bundleKeyShare
+}
+
+// bundleKeyShare is a KeyShare with its secret values exported.
+type bundleKeyShare struct {
+	Si         []byte
+	Id         uint16
+	KeyID      KeyID
+	Epoch      uint32
+	Name       string
+	MACSecrets [][]byte
+	MACKeys    []bundleMACKey
+}
+
+// bundleMACKey is a MACKey with its secret values exported.
+type bundleMACKey struct {
+	B []byte
+	C []byte
+}
+
+// bundleContent is the decoded plaintext of a bundle.
+type bundleContent struct {
+	KeyMeta   *KeyMeta
+	KeyShares KeyShareList
+}
+
+// NewDealer creates a dealer for the recipients provided, in the same order.
+// It returns an error if there are less than two recipients, if any name is empty or repeated, or if any public
+// key is not supported.
+func NewDealer(recipients []Recipient) (*Dealer, error) {
+	if len(recipients) < 2 {
+		return nil, fmt.Errorf("there should be at least 2 recipients, but there are %d", len(recipients))
+	}
+	names := make(map[string]bool, len(recipients))
+	for _, recipient := range recipients {
+		if recipient.Name == "" {
+			return nil, fmt.Errorf("recipient name is empty")
+		}
+		if names[recipient.Name] {
+			return nil, fmt.Errorf("there is more than one recipient named %q", recipient.Name)
+		}
+		names[recipient.Name] = true
+		if _, err := bundleScheme(recipient.PublicKey); err != nil {
+			return nil, fmt.Errorf("recipient %q: %v", recipient.Name, err)
+		}
+	}
+	return &Dealer{recipients: append([]Recipient{}, recipients...)}, nil
+}
+
+// bundleScheme returns the scheme used to encrypt bundles to the public key provided.
+// It returns an error if the public key is not supported.
+func bundleScheme(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case *ecdh.PublicKey:
+		if key.Curve() != ecdh.X25519() {
+			return "", fmt.Errorf("ECDH public keys should use the X25519 curve")
+		}
+		return BundleX25519, nil
+	case *rsa.PublicKey:
+		if key == nil || key.N == nil {
+			return "", fmt.Errorf("RSA public key is nil")
+		}
+		return BundleRSAOAEP, nil
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// Deal creates a k-threshold key as NewKey, with one participant for every recipient of the dealer, named as them,
+// and returns the bundles of the recipients, in the same order. The weights of the participants can be defined in
+// args, and then the number of shares of the key is the sum of the weights, but the participants cannot.
+// A dealer can only deal one key.
+// It returns the meta information of the key and the bundles, or an error if the key cannot be created or the
+// bundles cannot be encrypted.
+func (dealer *Dealer) Deal(bitSize int, k uint16, args *KeyMetaArgs) (*KeyMeta, []*Bundle, error) {
+	if dealer.meta != nil {
+		return nil, nil, fmt.Errorf("dealer has already dealt a key")
+	}
+	dealArgs := KeyMetaArgs{}
+	if args != nil {
+		dealArgs = *args
+	}
+	if len(dealArgs.Participants) != 0 {
+		return nil, nil, fmt.Errorf("participants of a dealer are defined by its recipients")
+	}
+	l := 0
+	dealArgs.Participants = make([]string, len(dealer.recipients))
+	for i, recipient := range dealer.recipients {
+		dealArgs.Participants[i] = recipient.Name
+		if weight, ok := dealArgs.Weights[recipient.Name]; ok {
+			l += int(weight)
+		} else {
+			l++
+		}
+	}
+	if l > maxL {
+		return nil, nil, fmt.Errorf("recipients have %d shares, but there can be at most %d", l, maxL)
+	}
+	shares, meta, err := NewKey(bitSize, k, uint16(l), &dealArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID, err := meta.ID()
+	if err != nil {
+		return nil, nil, err
+	}
+	bundles := make([]*Bundle, len(dealer.recipients))
+	hashes := make([]TranscriptBundle, len(dealer.recipients))
+	for i, recipient := range dealer.recipients {
+		participantShares := shares.Participant(recipient.Name)
+		bundles[i], err = sealBundle(recipient, keyID, meta, participantShares)
+		if err == nil {
+			hashes[i], err = bundles[i].transcriptBundle(participantShares)
+		}
+		if err != nil {
+			for _, keyShare := range shares {
+				keyShare.Destroy()
+			}
+			return nil, nil, err
+		}
+	}
+	dealer.meta = meta
+	dealer.shares = shares
+	dealer.bundles = hashes
+	dealer.dealtAt = time.Now().UTC().Round(0)
+	return meta, bundles, nil
+}
+
+// Maximum number of shares of a key.
+const maxL = 1<<16 - 1
+
+// Destroy overwrites the key shares kept by the dealer with zeros.
+func (dealer *Dealer) Destroy() {
+	for _, keyShare := range dealer.shares {
+		keyShare.Destroy()
+	}
+	dealer.shares = nil
+}
+
+// additionalData returns the additional data authenticated with the ciphertext of a bundle.
+func (bundle *Bundle) additionalData() []byte {
+	var buf bytes.Buffer
+	writeLengthPrefixed(&buf, []byte(bundleTag))
+	writeLengthPrefixed(&buf, []byte(bundle.Scheme))
+	writeLengthPrefixed(&buf, []byte(bundle.Name))
+	writeLengthPrefixed(&buf, bundle.KeyID)
+	writeLengthPrefixed(&buf, bundle.EncapsulatedKey)
+	return buf.Bytes()
+}
+
+// bundleKDF derives the key of a bundle from an X25519 shared secret with HKDF-SHA256, using the ephemeral and
+// the recipient public keys as salt.
+func bundleKDF(shared, ephemeral, recipient []byte) []byte {
+	extract := hmac.New(sha256.New, append(append([]byte{}, ephemeral...), recipient...))
+	extract.Write(shared)
+	prk := extract.Sum(nil)
+	defer wipeBytes(prk)
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte(bundleTag))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// sealBundle encrypts the key shares of a participant and the key meta information to its recipient.
+// It returns the bundle, or an error if the encryption fails.
+func sealBundle(recipient Recipient, keyID KeyID, meta *KeyMeta, shares KeyShareList) (*Bundle, error) {
+	scheme, err := bundleScheme(recipient.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{
+		Name:   recipient.Name,
+		KeyID:  append(KeyID{}, keyID...),
+		Scheme: scheme,
+	}
+	var key []byte
+	switch publicKey := recipient.PublicKey.(type) {
+	case *ecdh.PublicKey:
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := ephemeral.ECDH(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		bundle.EncapsulatedKey = ephemeral.PublicKey().Bytes()
+		key = bundleKDF(shared, bundle.EncapsulatedKey, publicKey.Bytes())
+		wipeBytes(shared)
+	case *rsa.PublicKey:
+		key = make([]byte, aeadKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if bundle.EncapsulatedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, []byte(bundleTag)); err != nil {
+			wipeBytes(key)
+			return nil, fmt.Errorf("cannot encrypt the bundle key to recipient %q: %v", recipient.Name, err)
+		}
+	}
+	defer wipeBytes(key)
+
+	payload := bundlePayload{KeyMeta: meta, KeyShares: make([]bundleKeyShare, len(shares))}
+	for i, keyShare := range shares {
+		exported := bundleKeyShare{
+			Si:      keyShare.Si.Export(),
+			Id:      keyShare.Id,
+			KeyID:   keyShare.KeyID,
+			Epoch:   keyShare.Epoch,
+			Name:    keyShare.Name,
+			MACKeys: make([]bundleMACKey, len(keyShare.MACKeys)),
+		}
+		for _, secret := range keyShare.MACSecrets {
+			exported.MACSecrets = append(exported.MACSecrets, secret.Export())
+		}
+		for j, macKey := range keyShare.MACKeys {
+			exported.MACKeys[j] = bundleMACKey{B: macKey.B.Export(), C: macKey.C.Export()}
+		}
+		payload.KeyShares[i] = exported
+	}
+	defer func() {
+		for _, exported := range payload.KeyShares {
+			wipeBytes(exported.Si)
+			for _, secret := range exported.MACSecrets {
+				wipeBytes(secret)
+			}
+			for _, macKey := range exported.MACKeys {
+				wipeBytes(macKey.B)
+				wipeBytes(macKey.C)
+			}
+		}
+	}()
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(plaintext)
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(bundle.Nonce); err != nil {
+		return nil, err
+	}
+	bundle.Ciphertext = aead.Seal(nil, bundle.Nonce, plaintext, bundle.additionalData())
+	return bundle, nil
+}
+
+// OpenBundle decrypts a bundle with the private key of its recipient, an *ecdh.PrivateKey of the X25519 curve or an
+// *rsa.PrivateKey, and validates its content: the key meta information should be valid and have the identifier of
+// the bundle, and the key shares should belong to the recipient and match their verification values.
+// It returns the key shares of the recipient and the key meta information, or an error if the bundle cannot be
+// decrypted or its content is invalid.
+func OpenBundle(bundle *Bundle, privateKey crypto.PrivateKey) (KeyShareList, *KeyMeta, error) {
+	if bundle == nil {
+		return nil, nil, fmt.Errorf("bundle is nil")
+	}
+	var key []byte
+	switch bundle.Scheme {
+	case BundleX25519:
+		ecdhKey, ok := privateKey.(*ecdh.PrivateKey)
+		if !ok || ecdhKey.Curve() != ecdh.X25519() {
+			return nil, nil, fmt.Errorf("bundle scheme %s needs an X25519 private key", bundle.Scheme)
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(bundle.EncapsulatedKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid bundle ephemeral key: %v", err)
+		}
+		shared, err := ecdhKey.ECDH(ephemeral)
+		if err != nil {
+			return nil, nil, err
+		}
+		key = bundleKDF(shared, bundle.EncapsulatedKey, ecdhKey.PublicKey().Bytes())
+		wipeBytes(shared)
+	case BundleRSAOAEP:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("bundle scheme %s needs an RSA private key", bundle.Scheme)
+		}
+		var err error
+		if key, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, rsaKey, bundle.EncapsulatedKey, []byte(bundleTag)); err != nil {
+			return nil, nil, fmt.Errorf("cannot decrypt the bundle key: %v", err)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown bundle scheme %q", bundle.Scheme)
+	}
+	defer wipeBytes(key)
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bundle.Nonce) != aead.NonceSize() {
+		return nil, nil, fmt.Errorf("bundle nonce has %d bytes, but it should have %d", len(bundle.Nonce), aead.NonceSize())
+	}
+	plaintext, err := aead.Open(nil, bundle.Nonce, bundle.Ciphertext, bundle.additionalData())
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decrypt the bundle: %v", err)
+	}
+	defer wipeBytes(plaintext)
+	var content bundleContent
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return nil, nil, fmt.Errorf("invalid bundle content: %v", err)
+	}
+	if err := content.validate(bundle); err != nil {
+		for _, keyShare := range content.KeyShares {
+			if keyShare != nil {
+				keyShare.Destroy()
+			}
+		}
+		return nil, nil, err
+	}
+	return content.KeyShares, content.KeyMeta, nil
+}
+
+// validate checks that the key meta information of the bundle content is valid and has the identifier of the
+// bundle, and that its key shares are all the key shares of the recipient of the bundle and match their
+// verification values.
+func (content bundleContent) validate(bundle *Bundle) error {
+	meta, err := content.KeyMeta.prepare()
+	if err != nil {
+		return fmt.Errorf("invalid bundle key meta information: %v", err)
+	}
+	if !meta.keyID.Equal(bundle.KeyID) {
+		return fmt.Errorf("bundle key meta information: %w", ErrKeyMismatch)
+	}
+	participant, ok := meta.participants[bundle.Name]
+	if !ok {
+		return fmt.Errorf("recipient %q is not a participant of the key", bundle.Name)
+	}
+	if len(content.KeyShares) != int(participant.weight()) {
+		return fmt.Errorf("bundle has %d key shares, but recipient %q has %d", len(content.KeyShares), bundle.Name, participant.weight())
+	}
+	for i, keyShare := range content.KeyShares {
+		if keyShare == nil || keyShare.Name != bundle.Name || keyShare.Id != participant.Id+uint16(i) {
+			return fmt.Errorf("key share %d of the bundle does not belong to recipient %q", i, bundle.Name)
+		}
+		if err := keyShare.checkKey(meta); err != nil {
+			return err
+		}
+		if err := keyShare.checkVerificationValue(meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkVerificationValue checks that v^S_i, computed in constant time, is the verification value of the key share.
+// It returns an error if it is not.
+func (keyShare KeyShare) checkVerificationValue(meta *PreparedKeyMeta) error {
+	vki, err := meta.verificationKey(keyShare.Id)
+	if err != nil {
+		return err
+	}
+	si, exp, err := keyShare.secretExponents(meta)
+	if err != nil {
+		return err
+	}
+	defer ctWipe(si)
+	defer ctWipe(exp)
+	if meta.ctN.exp(meta.v, si).Cmp(vki) != 0 {
+		return fmt.Errorf("key share with id %d does not match its verification value", keyShare.Id)
+	}
+	return nil
+}
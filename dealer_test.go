@@ -0,0 +1,134 @@
+package tcrsa_test
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+// dealerRecipients returns the recipients of the dealer tests, with their private keys: two with X25519 keys and
+// one with an RSA key.
+func dealerRecipients(t *testing.T) ([]tcrsa.Recipient, []crypto.PrivateKey) {
+	names := []string{"hsm-1", "hsm-2", "hsm-3"}
+	recipients := make([]tcrsa.Recipient, len(names))
+	privateKeys := make([]crypto.PrivateKey, len(names))
+	for i, name := range names {
+		if i < 2 {
+			privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			recipients[i] = tcrsa.Recipient{Name: name, PublicKey: privateKey.PublicKey()}
+			privateKeys[i] = privateKey
+		} else {
+			privateKey, err := rsa.GenerateKey(rand.Reader, escrowTestRecipientSize)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			recipients[i] = tcrsa.Recipient{Name: name, PublicKey: &privateKey.PublicKey}
+			privateKeys[i] = privateKey
+		}
+	}
+	return recipients, privateKeys
+}
+
+func TestDealer(t *testing.T) {
+	recipients, privateKeys := dealerRecipients(t)
+	dealer, err := tcrsa.NewDealer(recipients)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer dealer.Destroy()
+	args := fixedKeyArgs(t)
+	args.Weights = map[string]uint16{"hsm-3": 2}
+	keyMeta, bundles, err := dealer.Deal(keyTestFixedSize, 3, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if keyMeta.L != 4 || len(bundles) != len(recipients) {
+		t.Fatalf("key should have 4 shares in %d bundles, but it has %d shares in %d bundles", len(recipients), keyMeta.L, len(bundles))
+	}
+	if bundles[0].Scheme != tcrsa.BundleX25519 || bundles[2].Scheme != tcrsa.BundleRSAOAEP {
+		t.Errorf("bundles should use the schemes of the keys of the recipients")
+	}
+
+	docs, hashes := batchDocs(t, 1, keyMeta)
+	var sigShares tcrsa.SigShareList
+	for i, bundle := range bundles {
+		// The bundles can be sent as JSON.
+		encoded, err := json.Marshal(bundle)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		var received tcrsa.Bundle
+		if err := json.Unmarshal(encoded, &received); err != nil {
+			t.Fatalf("%v", err)
+		}
+		keyShares, openedMeta, err := tcrsa.OpenBundle(&received, privateKeys[i])
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(keyShares) != int(keyMeta.Weights()[recipients[i].Name]) {
+			t.Errorf("bundle of %s has %d key shares", recipients[i].Name, len(keyShares))
+		}
+		if i > 0 {
+			shares, err := keyShares.Sign(docs[0], keyTestHashType, openedMeta)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			sigShares = append(sigShares, shares...)
+		}
+	}
+	signature, err := sigShares.Join(docs[0], keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, hashes[0], signature); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	if _, _, err := tcrsa.OpenBundle(bundles[0], privateKeys[1]); err == nil {
+		t.Errorf("bundle should not be opened by another recipient")
+	}
+	if _, _, err := tcrsa.OpenBundle(bundles[2], privateKeys[0]); err == nil {
+		t.Errorf("bundle should not be opened with a key of another type")
+	}
+	renamed := *bundles[1]
+	renamed.Name = "hsm-1"
+	if _, _, err := tcrsa.OpenBundle(&renamed, privateKeys[1]); err == nil {
+		t.Errorf("bundle with a modified name should not be opened")
+	}
+	tampered := *bundles[2]
+	tampered.Ciphertext = append([]byte{}, tampered.Ciphertext...)
+	tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 1
+	if _, _, err := tcrsa.OpenBundle(&tampered, privateKeys[2]); err == nil {
+		t.Errorf("modified bundle should not be opened")
+	}
+	if _, _, err := dealer.Deal(keyTestFixedSize, 3, fixedKeyArgs(t)); err == nil {
+		t.Errorf("dealer should deal only one key")
+	}
+}
+
+func TestNewDealer_invalid(t *testing.T) {
+	recipients, _ := dealerRecipients(t)
+	if _, err := tcrsa.NewDealer(recipients[:1]); err == nil {
+		t.Errorf("dealer should need at least two recipients")
+	}
+	if _, err := tcrsa.NewDealer(append(recipients, recipients[0])); err == nil {
+		t.Errorf("recipient names should not be repeated")
+	}
+	p256, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := tcrsa.NewDealer(append(recipients, tcrsa.Recipient{Name: "p256", PublicKey: p256.PublicKey()})); err == nil {
+		t.Errorf("ECDH keys of curves other than X25519 should not be supported")
+	}
+	if _, err := tcrsa.NewDealer(append(recipients, tcrsa.Recipient{Name: "nil"})); err == nil {
+		t.Errorf("recipients should have a public key")
+	}
+}
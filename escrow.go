@@ -0,0 +1,171 @@
+package tcrsa
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+)
+
+// Label of the RSA-OAEP encryption of the escrow keys.
+const escrowLabel = "tcrsa/escrow/v1"
+
+// Size in bytes of the AES keys of the escrows and the share bundles.
+const aeadKeySize = 32
+
+// Escrow is a sealed copy of the full private key of a key, encrypted to the public key of an escrow recipient
+// for disaster recovery. The private key is stored in PKCS #1 DER form, encrypted with AES-256-GCM under a random
+// key, which is encrypted with RSA-OAEP and SHA-256 to the recipient. The ciphertext is bound to the key identifier.
+type Escrow struct {
+	KeyID      KeyID  // Identifier of the key.
+	WrappedKey []byte // AES key encrypted to the recipient with RSA-OAEP.
+	Nonce      []byte // Nonce of the AES-GCM encryption.
+	Ciphertext []byte // Private key encrypted with AES-GCM.
+}
+
+// NewKeyWithEscrow creates l key shares for a k-threshold signing scheme as NewKey, and also returns the full
+// private key of the scheme encrypted to the public key of the escrow recipient. The private key can be
+// recovered with RecoverEscrow by the holder of the private key of the recipient, so it should only be used by
+// deployments that require a sealed escrow copy of the key.
+// On success, it returns the meta information common to all the keys, an array with all the key shares and the
+// escrow. On failure, it returns an error and invalid pointers to shares, meta information and escrow.
+func NewKeyWithEscrow(bitSize int, k, l uint16, args *KeyMetaArgs, recipient *rsa.PublicKey) (shares KeyShareList, meta *KeyMeta, escrow *Escrow, err error) {
+	if recipient == nil || recipient.N == nil {
+		err = fmt.Errorf("escrow recipient is nil")
+		return
+	}
+	shares, meta, err = newThresholdKey(bitSize, k, l, args, func(meta *KeyMeta, keyID KeyID, p, q *big.Int) error {
+		var err error
+		escrow, err = sealEscrow(meta, keyID, p, q, recipient)
+		return err
+	})
+	return
+}
+
+// escrowPrivateKey returns the private key with the public key and the primes provided. The private exponent
+// is e^-1 mod lcm(p-1, q-1).
+// It returns an error if the private key is invalid.
+func escrowPrivateKey(publicKey *rsa.PublicKey, p, q *big.Int) (*rsa.PrivateKey, error) {
+	one := big.NewInt(1)
+	pMinus1 := new(big.Int).Sub(p, one)
+	qMinus1 := new(big.Int).Sub(q, one)
+	gcd := new(big.Int).GCD(nil, nil, pMinus1, qMinus1)
+	lambda := new(big.Int).Mul(pMinus1, qMinus1)
+	lambda.Quo(lambda, gcd)
+	defer wipeInts(pMinus1, qMinus1, lambda)
+	d := new(big.Int).ModInverse(big.NewInt(int64(publicKey.E)), lambda)
+	if d == nil {
+		return nil, fmt.Errorf("public exponent is not invertible")
+	}
+	privateKey := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: new(big.Int).Set(publicKey.N), E: publicKey.E},
+		D:         d,
+		Primes:    []*big.Int{new(big.Int).Set(p), new(big.Int).Set(q)},
+	}
+	if err := privateKey.Validate(); err != nil {
+		return nil, err
+	}
+	privateKey.Precompute()
+	return privateKey, nil
+}
+
+// sealEscrow encrypts the private key of a new key to the escrow recipient.
+// It returns the escrow, or an error if the encryption fails.
+func sealEscrow(meta *KeyMeta, keyID KeyID, p, q *big.Int, recipient *rsa.PublicKey) (*Escrow, error) {
+	privateKey, err := escrowPrivateKey(meta.PublicKey, p, q)
+	if err != nil {
+		return nil, err
+	}
+	der := x509.MarshalPKCS1PrivateKey(privateKey)
+	defer wipeBytes(der)
+	defer wipePrivateKey(privateKey)
+
+	key := make([]byte, aeadKeySize)
+	defer wipeBytes(key)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, recipient, key, []byte(escrowLabel))
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt the escrow key to the recipient: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &Escrow{
+		KeyID:      append(KeyID{}, keyID...),
+		WrappedKey: wrappedKey,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, der, keyID),
+	}, nil
+}
+
+// newAEAD returns the AES-GCM cipher of a 256 bit key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wipePrivateKey overwrites the secret values of a private key with zeros.
+func wipePrivateKey(privateKey *rsa.PrivateKey) {
+	wipeInts(privateKey.D)
+	wipeInts(privateKey.Primes...)
+	wipeInts(privateKey.Precomputed.Dp, privateKey.Precomputed.Dq, privateKey.Precomputed.Qinv)
+}
+
+// RecoverEscrow decrypts an escrow with the private key of its recipient, and checks that the private key it
+// contains belongs to the key of the key meta information.
+// It returns the private key, or an error if the escrow cannot be decrypted or it belongs to another key.
+func RecoverEscrow(escrow *Escrow, recipient *rsa.PrivateKey, info MetaInfo) (*rsa.PrivateKey, error) {
+	if escrow == nil {
+		return nil, fmt.Errorf("escrow is nil")
+	}
+	if recipient == nil {
+		return nil, fmt.Errorf("escrow recipient is nil")
+	}
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	if !escrow.KeyID.Equal(meta.keyID) {
+		return nil, fmt.Errorf("escrow: %w", ErrKeyMismatch)
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, recipient, escrow.WrappedKey, []byte(escrowLabel))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt the escrow key: %v", err)
+	}
+	defer wipeBytes(key)
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(escrow.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("escrow nonce has %d bytes, but it should have %d", len(escrow.Nonce), aead.NonceSize())
+	}
+	der, err := aead.Open(nil, escrow.Nonce, escrow.Ciphertext, meta.keyID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt the escrow: %v", err)
+	}
+	defer wipeBytes(der)
+	privateKey, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid escrowed private key: %v", err)
+	}
+	if privateKey.N.Cmp(meta.PublicKey.N) != 0 || privateKey.E != meta.PublicKey.E {
+		wipePrivateKey(privateKey)
+		return nil, fmt.Errorf("escrowed private key does not match the public key of the key")
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,88 @@
+package tcrsa_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+const escrowTestRecipientSize = 1024
+
+func TestNewKeyWithEscrow(t *testing.T) {
+	recipient, err := rsa.GenerateKey(rand.Reader, escrowTestRecipientSize)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	keyShares, keyMeta, escrow, err := tcrsa.NewKeyWithEscrow(keyTestFixedSize, keyTestK, keyTestL, fixedKeyArgs(t), &recipient.PublicKey)
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	keyID, err := keyMeta.ID()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !escrow.KeyID.Equal(keyID) {
+		t.Errorf("escrow should have the identifier of the key")
+	}
+
+	privateKey, err := tcrsa.RecoverEscrow(escrow, recipient, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// PKCS #1 v1.5 signatures are deterministic, so the escrowed key signs as the key shares.
+	docs, hashes := batchDocs(t, 1, keyMeta)
+	sigShares := make(tcrsa.SigShareList, keyTestK)
+	for i := range sigShares {
+		if sigShares[i], err = keyShares[i].Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	signature, err := sigShares.Join(docs[0], keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	escrowSignature, err := rsa.SignPKCS1v15(nil, privateKey, crypto.SHA256, hashes[0])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(signature, escrowSignature) {
+		t.Errorf("escrowed key should generate the same signatures as the key shares")
+	}
+}
+
+func TestRecoverEscrow_invalid(t *testing.T) {
+	recipient, err := rsa.GenerateKey(rand.Reader, escrowTestRecipientSize)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, escrowTestRecipientSize)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, _, _, err := tcrsa.NewKeyWithEscrow(keyTestFixedSize, keyTestK, keyTestL, fixedKeyArgs(t), nil); err == nil {
+		t.Errorf("escrow recipient should be required")
+	}
+	_, keyMeta, escrow, err := tcrsa.NewKeyWithEscrow(keyTestFixedSize, keyTestK, keyTestL, fixedKeyArgs(t), &recipient.PublicKey)
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+
+	if _, err := tcrsa.RecoverEscrow(escrow, other, keyMeta); err == nil {
+		t.Errorf("escrow should not be recovered by another recipient")
+	}
+	// The same primes dealt again create another key.
+	_, otherMeta := fixedKey(t)
+	if _, err := tcrsa.RecoverEscrow(escrow, recipient, otherMeta); !errors.Is(err, tcrsa.ErrKeyMismatch) {
+		t.Errorf("escrow of another key should be rejected with ErrKeyMismatch, but the error is %v", err)
+	}
+	tampered := *escrow
+	tampered.Ciphertext = append([]byte{}, escrow.Ciphertext...)
+	tampered.Ciphertext[0] ^= 1
+	if _, err := tcrsa.RecoverEscrow(&tampered, recipient, keyMeta); err == nil {
+		t.Errorf("modified escrow should not be recovered")
+	}
+}
@@ -0,0 +1,167 @@
+package tcrsa
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Window size in bits of the fixed-base exponentiation tables.
+const fixedBaseWindow = 6
+
+// fixedBaseTable stores the powers g^(2^(w*j)) mod n of a fixed base g, to compute g^x mod n with
+// the fixed-base windowing method of Brickell, Gordon, McCurley and Wilson. It is read only after its
+// creation, so it can be shared between goroutines.
+type fixedBaseTable struct {
+	n       *big.Int
+	maxBits int
+	powers  []*big.Int
+}
+
+// newFixedBaseTable precomputes the table of g mod n for exponents of at most maxBits bits.
+func newFixedBaseTable(g, n *big.Int, maxBits int) *fixedBaseTable {
+	t := &fixedBaseTable{
+		n:       n,
+		maxBits: maxBits,
+		powers:  make([]*big.Int, (maxBits+fixedBaseWindow-1)/fixedBaseWindow),
+	}
+	power := new(big.Int).Mod(g, n)
+	for j := range t.powers {
+		t.powers[j] = new(big.Int).Set(power)
+		for k := 0; k < fixedBaseWindow; k++ {
+			power.Mul(power, power).Mod(power, n)
+		}
+	}
+	return t
+}
+
+// exp returns g^x mod n. x should be non negative. If x has more bits than the ones the table was
+// created for, it falls back to big.Int Exp.
+func (t *fixedBaseTable) exp(x *big.Int) *big.Int {
+	if x.Sign() < 0 || x.BitLen() > t.maxBits {
+		return new(big.Int).Exp(t.powers[0], x, t.n)
+	}
+	// Group the powers by the value of their window in x.
+	buckets := make([][]int, 1<<fixedBaseWindow)
+	for j := range t.powers {
+		var d uint
+		for k := 0; k < fixedBaseWindow; k++ {
+			d |= x.Bit(j*fixedBaseWindow+k) << uint(k)
+		}
+		if d != 0 {
+			buckets[d] = append(buckets[d], j)
+		}
+	}
+	// a = prod_d (prod_{x_j = d} g_j)^d
+	a := big.NewInt(1)
+	b := big.NewInt(1)
+	for d := len(buckets) - 1; d >= 1; d-- {
+		for _, j := range buckets[d] {
+			b.Mul(b, t.powers[j]).Mod(b, t.n)
+		}
+		a.Mul(a, b).Mod(a, t.n)
+	}
+	return a
+}
+
+// Maximum window size in bits of the simultaneous multi-exponentiation.
+const multiExpMaxWindow = 5
+
+// Estimated costs used to choose between a simultaneous multi-exponentiation and a big.Int Exp call for each
+// base. The multi-exponentiation multiplies with Mul and Mod, which is about two times slower than the
+// Montgomery multiplication used by Exp for exponents of more than one word, while each of these Exp calls has
+// a fixed setup cost. Exp uses Mul and Mod too for exponents of one word.
+const (
+	mulModCost   = 5
+	montMulCost  = 2
+	expSetupCost = 200
+)
+
+// multiExp returns prod(bases[i]^exps[i]) mod n. Bases with negative exponents are inverted modulo n.
+// It uses the simultaneous exponentiation method of Straus (Shamir's trick for two bases), which shares
+// the squarings between all the bases, unless computing each power separately is estimated to be cheaper.
+// It returns an error if a base with a negative exponent is not invertible modulo n.
+func multiExp(bases, exps []*big.Int, n *big.Int) (*big.Int, error) {
+	gs := make([]*big.Int, len(bases))
+	xs := make([]*big.Int, len(exps))
+	maxBits, sumBits := 0, 0
+	for i := range bases {
+		gs[i], xs[i] = bases[i], exps[i]
+		if xs[i].Sign() < 0 {
+			gs[i] = new(big.Int).ModInverse(bases[i], n)
+			if gs[i] == nil {
+				return nil, fmt.Errorf("base %d is not invertible", i)
+			}
+			xs[i] = new(big.Int).Neg(exps[i])
+		}
+		if xs[i].BitLen() > maxBits {
+			maxBits = xs[i].BitLen()
+		}
+		sumBits += xs[i].BitLen()
+	}
+
+	window, strausCost := multiExpWindow(len(gs), maxBits, sumBits)
+	separateCost := 0
+	for _, x := range xs {
+		if x.BitLen() <= 64 {
+			separateCost += mulModCost * (x.BitLen() + x.BitLen()/2)
+		} else {
+			separateCost += montMulCost*(x.BitLen()+x.BitLen()/4) + expSetupCost
+		}
+	}
+	if separateCost <= strausCost {
+		result := big.NewInt(1)
+		aux := new(big.Int)
+		for i := range gs {
+			aux.Exp(gs[i], xs[i], n)
+			result.Mul(result, aux).Mod(result, n)
+		}
+		return result, nil
+	}
+	return straus(gs, xs, maxBits, window, n), nil
+}
+
+// multiExpWindow returns the window size that minimizes the estimated cost of a simultaneous exponentiation
+// of k bases, and that cost. A bigger window means less multiplications per exponent, but bigger tables.
+func multiExpWindow(k, maxBits, sumBits int) (window, cost int) {
+	for w := 1; w <= multiExpMaxWindow; w++ {
+		c := mulModCost * (maxBits + sumBits/w + k*((1<<uint(w))-2))
+		if w == 1 || c < cost {
+			window, cost = w, c
+		}
+	}
+	return
+}
+
+// straus returns prod(bases[i]^exps[i]) mod n with non negative exponents of at most maxBits bits, processing
+// the windows of the given size of all the exponents at the same time from the most significant one.
+func straus(bases, exps []*big.Int, maxBits, window int, n *big.Int) *big.Int {
+	// tables[i][d] = bases[i]^d mod n
+	tables := make([][]*big.Int, len(bases))
+	for i, g := range bases {
+		tables[i] = make([]*big.Int, 1<<uint(window))
+		tables[i][1] = new(big.Int).Mod(g, n)
+		for d := 2; d < len(tables[i]); d++ {
+			tables[i][d] = new(big.Int).Mul(tables[i][d-1], tables[i][1])
+			tables[i][d].Mod(tables[i][d], n)
+		}
+	}
+	result := big.NewInt(1)
+	windows := (maxBits + window - 1) / window
+	for j := windows - 1; j >= 0; j-- {
+		if j != windows-1 {
+			for k := 0; k < window; k++ {
+				result.Mul(result, result).Mod(result, n)
+			}
+		}
+		for i, x := range exps {
+			var d uint
+			for k := 0; k < window; k++ {
+				d |= x.Bit(j*window+k) << uint(k)
+			}
+			if d != 0 {
+				result.Mul(result, tables[i][d]).Mod(result, n)
+			}
+		}
+	}
+	return result
+}
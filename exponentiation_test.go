@@ -0,0 +1,196 @@
+package tcrsa
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+const exponentiationTestBitLen = 512
+const exponentiationTestRounds = 20
+
+func TestFixedBaseTable_exp(t *testing.T) {
+	n, err := randInt(exponentiationTestBitLen)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	n.SetBit(n, 0, 1)
+	g, err := randInt(exponentiationTestBitLen - 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	table := newFixedBaseTable(g, n, 2*exponentiationTestBitLen)
+	for i := 0; i < exponentiationTestRounds; i++ {
+		// The last exponents are bigger than the table, so they test the fallback.
+		x, err := randInt(exponentiationTestBitLen * (i + 1) / 6)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		expected := new(big.Int).Exp(g, x, n)
+		if res := table.exp(x); res.Cmp(expected) != 0 {
+			t.Errorf("g^x is %s, but it should be %s", res, expected)
+		}
+	}
+	if res := table.exp(new(big.Int)); res.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("g^0 is %s, but it should be 1", res)
+	}
+}
+
+func TestMultiExp(t *testing.T) {
+	p, err := rand.Prime(rand.Reader, exponentiationTestBitLen/2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	q, err := rand.Prime(rand.Reader, exponentiationTestBitLen/2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	n := new(big.Int).Mul(p, q)
+	for _, k := range []int{1, 2, 3, 10} {
+		for _, bitLen := range []int{8, 64, exponentiationTestBitLen * 2} {
+			bases := make([]*big.Int, k)
+			exps := make([]*big.Int, k)
+			for i := range bases {
+				if bases[i], err = randInt(exponentiationTestBitLen - 1); err != nil {
+					t.Fatalf("%v", err)
+				}
+				if exps[i], err = randInt(bitLen); err != nil {
+					t.Fatalf("%v", err)
+				}
+				if i%2 == 1 {
+					exps[i].Neg(exps[i])
+				}
+			}
+			expected := big.NewInt(1)
+			for i := range bases {
+				expected.Mul(expected, new(big.Int).Exp(bases[i], exps[i], n)).Mod(expected, n)
+			}
+			res, err := multiExp(bases, exps, n)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if res.Cmp(expected) != 0 {
+				t.Errorf("multiExp with %d bases of %d bits is %s, but it should be %s", k, bitLen, res, expected)
+			}
+			for i := range exps {
+				exps[i].Abs(exps[i])
+			}
+			expected.SetInt64(1)
+			for i := range bases {
+				expected.Mul(expected, new(big.Int).Exp(bases[i], exps[i], n)).Mod(expected, n)
+			}
+			if res := straus(bases, exps, bitLen, k%multiExpMaxWindow+1, n); res.Cmp(expected) != 0 {
+				t.Errorf("straus with %d bases of %d bits is %s, but it should be %s", k, bitLen, res, expected)
+			}
+		}
+	}
+	if _, err := multiExp([]*big.Int{p}, []*big.Int{big.NewInt(-1)}, n); err == nil {
+		t.Errorf("multiExp should fail with a negative exponent of a non invertible base")
+	}
+}
+
+// exponentiationBenchmarkModuli caches the random moduli used in the benchmarks, by bit size.
+var exponentiationBenchmarkModuli = make(map[int]*big.Int)
+
+func exponentiationBenchmarkModulus(b *testing.B, bitSize int) *big.Int {
+	if n, ok := exponentiationBenchmarkModuli[bitSize]; ok {
+		return n
+	}
+	p, err := rand.Prime(rand.Reader, bitSize/2)
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	q, err := rand.Prime(rand.Reader, bitSize-bitSize/2)
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	n := new(big.Int).Mul(p, q)
+	exponentiationBenchmarkModuli[bitSize] = n
+	return n
+}
+
+// Benchmarks the product of the K powers in Join, with l = 2k - 1 shares, computing each power separately as
+// before and with multiExp.
+func BenchmarkJoinProduct(b *testing.B) {
+	for _, bitSize := range []int{2048, 4096} {
+		for _, k := range []int{3, 5, 10, 20, 50} {
+			n := exponentiationBenchmarkModulus(b, bitSize)
+			l := 2*k - 1
+			delta := new(big.Int).MulRange(1, int64(l))
+			ids := make([]int64, k)
+			for i := range ids {
+				ids[i] = int64(i + 1)
+			}
+			mus, d, err := lagrangeCoefficients(ids, 0)
+			if err != nil {
+				b.Fatalf("%v", err)
+			}
+			factor := new(big.Int).Quo(delta, d)
+			xis := make([]*big.Int, k)
+			lambdas2 := make([]*big.Int, k)
+			for i := range xis {
+				if xis[i], err = randInt(bitSize - 1); err != nil {
+					b.Fatalf("%v", err)
+				}
+				// 2 * delta * L_i(0), as the exponents of Join were computed before d was introduced.
+				lambdas2[i] = new(big.Int).Mul(mus[i], factor)
+				lambdas2[i].Lsh(lambdas2[i], 1)
+			}
+			b.Run(fmt.Sprintf("%d/K=%d/separate", bitSize, k), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					w := big.NewInt(1)
+					aux := new(big.Int)
+					for j := range xis {
+						aux.Exp(xis[j], lambdas2[j], n)
+						w.Mul(w, aux)
+					}
+					w.Mod(w, n)
+				}
+			})
+			b.Run(fmt.Sprintf("%d/K=%d/multiExp", bitSize, k), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := multiExp(xis, lambdas2, n); err != nil {
+						b.Fatalf("%v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Benchmarks the products of two powers computed in Verify, computing each power separately as before and with multiExp.
+func BenchmarkVerifyProducts(b *testing.B) {
+	for _, bitSize := range []int{2048, 4096} {
+		n := exponentiationBenchmarkModulus(b, bitSize)
+		bases := make([]*big.Int, 2)
+		exps := make([]*big.Int, 2)
+		var err error
+		for i := range bases {
+			if bases[i], err = randInt(bitSize - 1); err != nil {
+				b.Fatalf("%v", err)
+			}
+		}
+		// z has the size of the random value r, and c is a SHA-256 hash.
+		if exps[0], err = randInt(bitSize + 512); err != nil {
+			b.Fatalf("%v", err)
+		}
+		if exps[1], err = randInt(256); err != nil {
+			b.Fatalf("%v", err)
+		}
+		exps[1].Neg(exps[1])
+		b.Run(fmt.Sprintf("%d/separate", bitSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				aux := new(big.Int).Exp(bases[0], exps[0], n)
+				aux.Mul(aux, new(big.Int).Exp(bases[1], exps[1], n)).Mod(aux, n)
+			}
+		})
+		b.Run(fmt.Sprintf("%d/multiExp", bitSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := multiExp(bases, exps, n); err != nil {
+					b.Fatalf("%v", err)
+				}
+			}
+		})
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/niclabs/tcrsa
 
-go 1.12
+go 1.20
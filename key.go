@@ -7,6 +7,8 @@ import (
 	"crypto/rsa"
 	"fmt"
 	"math/big"
+	"runtime"
+	"sync"
 )
 
 // Minimum bit size for the key generation: 512 bits.
@@ -25,16 +27,16 @@ const f4 = 65537
 // On success, it returns the meta information common to all the keys, and an array with all the key shares.
 // On failure, it returns an error and invalid pointers to shares and meta information.
 func NewKey(bitSize int, k, l uint16, args *KeyMetaArgs) (shares KeyShareList, meta *KeyMeta, err error) {
+	return newThresholdKey(bitSize, k, l, args, nil)
+}
 
+// newThresholdKey checks the parameters of a k-of-l key and creates it, passing the seal function to newKey.
+func newThresholdKey(bitSize int, k, l uint16, args *KeyMetaArgs, seal sealFunc) (shares KeyShareList, meta *KeyMeta, err error) {
 	if args == nil {
 		args = &KeyMetaArgs{}
 	}
 
 	// Parameter checking
-	if bitSize < minBitSize || bitSize > maxBitSize {
-		err = fmt.Errorf("bit size should be between %d and %d, but it is %d", minBitSize, maxBitSize, bitSize)
-		return
-	}
 	if l <= 1 {
 		err = fmt.Errorf("l should be greater than 1, but it is %d", l)
 		return
@@ -47,6 +49,71 @@ func NewKey(bitSize int, k, l uint16, args *KeyMetaArgs) (shares KeyShareList, m
 		err = fmt.Errorf("k should be between the %d and %d, but it is %d", (l/2)+1, l, k)
 		return
 	}
+	if err = checkMode(args.Mode, k, l); err != nil {
+		return
+	}
+	var participants []Participant
+	if len(args.Participants) != 0 {
+		if participants, err = newParticipants(args.Participants, args.Weights, args.Ids, l); err != nil {
+			return
+		}
+	} else if len(args.Weights) != 0 || len(args.Ids) != 0 {
+		err = fmt.Errorf("weights and ids can only be assigned to named participants")
+		return
+	}
+	return newKey(bitSize, k, l, args, participants, nil, seal)
+}
+
+// NewKeyWithPolicy creates key shares for the participants of an access structure policy, such as
+// "and(thresh(2, alice, bob, carol), thresh(3, dave, erin, frank, grace, heidi))", which can sign together
+// only if they satisfy the policy. The syntax of the policies is described in KeyMeta.Policy.
+// The bit_size parameter is used to generate key shares with a security level equivalent to a RSA private of that size.
+// Every participant named in the policy receives one key share, with the ids assigned in the order they appear
+// in the policy, so args cannot define participants or weights. The threshold of the key meta information is the
+// size of the smallest set of participants that satisfies the policy.
+// On success, it returns the meta information common to all the keys, and an array with all the key shares.
+// On failure, it returns an error and invalid pointers to shares and meta information.
+func NewKeyWithPolicy(bitSize int, policy string, args *KeyMetaArgs) (shares KeyShareList, meta *KeyMeta, err error) {
+	if args == nil {
+		args = &KeyMetaArgs{}
+	}
+	if len(args.Participants) != 0 || len(args.Weights) != 0 || len(args.Ids) != 0 {
+		err = fmt.Errorf("participants of a policy key are defined by the policy")
+		return
+	}
+	if args.Mode != ShamirSharing {
+		err = fmt.Errorf("policy keys cannot use %s sharing mode", args.Mode)
+		return
+	}
+	root, err := parsePolicy(policy)
+	if err != nil {
+		return
+	}
+	leaves := root.leaves()
+	if len(leaves) <= 1 {
+		err = fmt.Errorf("policy should have more than 1 participant, but it has %d", len(leaves))
+		return
+	}
+	participants := make([]Participant, len(leaves))
+	for i, leaf := range leaves {
+		participants[i] = Participant{Name: leaf.name, Id: leaf.id}
+	}
+	return newKey(bitSize, uint16(root.minSigners()), uint16(len(leaves)), args, participants, root, nil)
+}
+
+// sealFunc receives the primes of a new key and its meta information, after the key shares are created and
+// before the primes are wiped.
+type sealFunc func(meta *KeyMeta, keyID KeyID, p, q *big.Int) error
+
+// newKey creates l key shares with the parameters already checked by NewKey or NewKeyWithPolicy. Without a
+// policy, the key shares are the points of a random polynomial of degree k-1, or random summands in additive
+// sharing mode. With a policy, they are dealt recursively through the nodes of the policy. If seal is not nil, it
+// is called with the primes of the key once the key shares are created.
+func newKey(bitSize int, k, l uint16, args *KeyMetaArgs, participants []Participant, policy *policyNode, seal sealFunc) (shares KeyShareList, meta *KeyMeta, err error) {
+	if bitSize < minBitSize || bitSize > maxBitSize {
+		err = fmt.Errorf("bit size should be between %d and %d, but it is %d", minBitSize, maxBitSize, bitSize)
+		return
+	}
 
 	pPrimeSize := (bitSize + 1) / 2
 	qPrimeSize := bitSize - pPrimeSize - 1
@@ -60,11 +127,27 @@ func NewKey(bitSize int, k, l uint16, args *KeyMetaArgs) (shares KeyShareList, m
 		return
 	}
 
+	proofParams, err := args.ProofParams.resolve(bitSize)
+	if err != nil {
+		return
+	}
+	if err = checkVerificationMode(args.Verification); err != nil {
+		return
+	}
+
 	meta = &KeyMeta{
 		PublicKey:       &rsa.PublicKey{},
 		K:               k,
 		L:               l,
 		VerificationKey: NewVerificationKey(l),
+		ProofParams:     proofParams,
+		Epoch:           args.Epoch,
+		Participants:    participants,
+		Mode:            args.Mode,
+		Verification:    args.Verification,
+	}
+	if policy != nil {
+		meta.Policy = policy.String()
 	}
 	shares = make(KeyShareList, meta.L)
 
@@ -88,7 +171,16 @@ func NewKey(bitSize int, k, l uint16, args *KeyMetaArgs) (shares KeyShareList, m
 	r := new(big.Int)
 	vkv := new(big.Int)
 	vku := new(big.Int)
-	vki := new(big.Int)
+	var poly polynomial
+	var values []*big.Int
+
+	// Wipe the secret intermediate values when the key shares are created or the creation fails.
+	// The values provided in args belong to the caller, so they are copied and not wiped.
+	defer func() {
+		wipeInts(pr, qr, p, q, d, m, deltaInv, r)
+		poly.wipe()
+		wipeInts(values...)
+	}()
 
 	if args.P != nil {
 		if !args.P.ProbablyPrime(c) {
@@ -178,28 +270,98 @@ func NewKey(bitSize int, k, l uint16, args *KeyMetaArgs) (shares KeyShareList, m
 
 	meta.VerificationKey.U = vku.Bytes()
 
-	// Delta is fact(l)
-	deltaInv.MulRange(1, int64(l)).ModInverse(deltaInv, m)
+	if policy != nil {
+		// Deal the shares through the policy.
+		values = make([]*big.Int, l)
+		if err = policy.deal(d, m, values); err != nil {
+			return
+		}
+	} else if args.Mode == AdditiveSharing {
+		// Split d into l summands.
+		if values, err = additiveShares(d, m, l); err != nil {
+			return
+		}
+	} else {
+		// Delta is fact(l)
+		deltaInv.MulRange(1, int64(l)).ModInverse(deltaInv, m)
+
+		// Generate polynomial with random coefficients.
+		poly, err = createRandomPolynomial(int(k-1), d, m)
 
-	// Generate polynomial with random coefficients.
-	var poly polynomial
-	poly, err = createRandomPolynomial(int(k-1), d, m)
+		if err != nil {
+			return
+		}
+	}
 
+	// Calculate Key Shares for each i TC participant. The verification values v^si are computed in constant
+	// time, concurrently for large values of l.
+	ctN, err := newCtModulus(n)
 	if err != nil {
 		return
 	}
-
-	// Calculate Key Shares for each i TC participant.
+	limbs := ctLimbsLen(n.BitLen())
+	workers := runtime.NumCPU()
+	if workers > int(meta.L) {
+		workers = int(meta.L)
+	}
+	ids := make(chan uint16)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range ids {
+				keyShare := shares[i-1]
+				keyShare.Id = i
+				var si *big.Int
+				if values != nil {
+					si = new(big.Int).Set(values[i-1])
+				} else {
+					si = poly.evalMod(big.NewInt(int64(i)), m)
+					si.Mul(si, deltaInv)
+					si.Mod(si, m)
+				}
+				keyShare.Si = si.Bytes()
+				siBytes := si.FillBytes(make([]byte, 8*limbs))
+				siLimbs, _ := ctLimbsFromBytes(siBytes, limbs)
+				meta.VerificationKey.I[i-1] = ctN.exp(vkv, siLimbs).Bytes()
+				wipeBytes(siBytes)
+				ctWipe(siLimbs)
+				wipeInts(si)
+			}
+		}()
+	}
 	for i = 1; i <= meta.L; i++ {
-		keyShare := shares[i-1]
-		keyShare.Id = i
-		si := poly.eval(big.NewInt(int64(i)))
-		si.Mul(si, deltaInv)
-		si.Mod(si, m)
-		keyShare.Si = si.Bytes()
-		vki.Exp(vkv, si, n)
-
-		meta.VerificationKey.I[i-1] = vki.Bytes()
+		ids <- i
+	}
+	close(ids)
+	wg.Wait()
+
+	if args.Verification == MACVerification {
+		if err = dealMACs(shares, proofParams, n.BitLen()); err != nil {
+			return
+		}
+	}
+
+	keyID, err := meta.ID()
+	if err != nil {
+		return
+	}
+	for _, keyShare := range shares {
+		keyShare.KeyID = append(KeyID{}, keyID...)
+		keyShare.Epoch = meta.Epoch
+	}
+	for _, participant := range participants {
+		for j := uint16(0); j < participant.weight(); j++ {
+			shares[participant.Id+j-1].Name = participant.Name
+		}
+	}
+	if seal != nil {
+		if err = seal(meta, keyID, p, q); err != nil {
+			for _, keyShare := range shares {
+				keyShare.Destroy()
+			}
+		}
 	}
 	return
 }
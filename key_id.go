@@ -0,0 +1,92 @@
+package tcrsa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+// KeyID is the identifier of a key: the SHA-256 hash of its public key, its threshold parameters and its
+// verification key. Keys with the same public key but created by different dealings have different
+// identifiers, as their shares cannot be combined.
+type KeyID []byte
+
+// String returns the fingerprint of the key identifier in the format of OpenSSH: "SHA256:" followed by the
+// identifier encoded in standard Base64 without padding.
+func (id KeyID) String() string {
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(id)
+}
+
+// Hex returns the fingerprint of the key identifier as lowercase hexadecimal bytes separated by colons.
+func (id KeyID) Hex() string {
+	parts := make([]string, len(id))
+	for i := range id {
+		parts[i] = hex.EncodeToString(id[i : i+1])
+	}
+	return strings.Join(parts, ":")
+}
+
+// Equal returns true if both key identifiers are equal.
+func (id KeyID) Equal(id2 KeyID) bool {
+	return bytes.Equal(id, id2)
+}
+
+// ID returns the identifier of the key.
+// It returns an error if the key meta information is invalid.
+func (keyMeta *KeyMeta) ID() (KeyID, error) {
+	prepared, err := keyMeta.prepare()
+	if err != nil {
+		return nil, err
+	}
+	return prepared.ID()
+}
+
+// ID returns the identifier of the key. It never returns an error for key meta information created with
+// KeyMeta.Prepare.
+func (prepared *PreparedKeyMeta) ID() (KeyID, error) {
+	if _, err := prepared.prepare(); err != nil {
+		return nil, err
+	}
+	return append(KeyID{}, prepared.keyID...), nil
+}
+
+// Domain separation tag of the key identifiers.
+const keyIDTag = "tcrsa/key-id/v1"
+
+// computeKeyID returns the identifier of the key defined by the prepared key meta information.
+func (prepared *PreparedKeyMeta) computeKeyID() KeyID {
+	sha := sha256.New()
+	writeLengthPrefixed(sha, []byte(keyIDTag))
+	writeLengthPrefixed(sha, prepared.n.Bytes())
+	writeLengthPrefixed(sha, prepared.e.Bytes())
+	var kl [4]byte
+	binary.BigEndian.PutUint16(kl[:2], prepared.K)
+	binary.BigEndian.PutUint16(kl[2:], prepared.L)
+	writeLengthPrefixed(sha, kl[:])
+	writeLengthPrefixed(sha, prepared.v.Bytes())
+	writeLengthPrefixed(sha, prepared.u.Bytes())
+	for _, vki := range prepared.vk {
+		writeLengthPrefixed(sha, vki.Bytes())
+	}
+	// The policy and the sharing and verification modes are only hashed when they are not the default ones, so
+	// the identifiers of k-of-l keys do not change.
+	if prepared.policy != nil {
+		writeLengthPrefixed(sha, []byte(prepared.policy.String()))
+	}
+	if prepared.Mode != ShamirSharing {
+		writeLengthPrefixed(sha, []byte(prepared.Mode.String()))
+	}
+	if prepared.Verification != ProofVerification {
+		writeLengthPrefixed(sha, []byte(prepared.Verification.String()))
+	}
+	return sha.Sum(nil)
+}
+
+// documentDigest returns the digest of a prepared document stored in the signature shares.
+func documentDigest(doc []byte) []byte {
+	digest := sha256.Sum256(doc)
+	return digest[:]
+}
@@ -0,0 +1,88 @@
+package tcrsa_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/niclabs/tcrsa"
+	"math/big"
+	"regexp"
+	"testing"
+)
+
+func TestKeyMeta_ID(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	id, err := keyMeta.ID()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(id) != 32 {
+		t.Errorf("key id should have 32 bytes, but it has %d", len(id))
+	}
+	prepared, err := keyMeta.Prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	preparedID, err := prepared.ID()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !id.Equal(preparedID) {
+		t.Errorf("key id of the prepared key meta should be %s, but it is %s", id, preparedID)
+	}
+	for _, keyShare := range keyShares {
+		if !keyShare.KeyID.Equal(id) {
+			t.Errorf("key share %d should have key id %s, but it has %s", keyShare.Id, id, keyShare.KeyID)
+		}
+	}
+
+	// The id is stable for the same key, and changes with the verification key.
+	b, err := json.Marshal(keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	sameMeta := &tcrsa.KeyMeta{}
+	if err := json.Unmarshal(b, sameMeta); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if sameID, err := sameMeta.ID(); err != nil || !sameID.Equal(id) {
+		t.Errorf("key id should be stable, but it is %s and %s", id, sameID)
+	}
+	other := *keyMeta
+	otherVK := *keyMeta.VerificationKey
+	otherVK.V = new(big.Int).Add(new(big.Int).SetBytes(otherVK.V), big.NewInt(1)).Bytes()
+	other.VerificationKey = &otherVK
+	if otherID, err := other.ID(); err != nil || otherID.Equal(id) {
+		t.Errorf("key id should change with the verification key")
+	}
+
+	if !regexp.MustCompile(`^SHA256:[A-Za-z0-9+/]{43}$`).MatchString(id.String()) {
+		t.Errorf("invalid SSH style fingerprint %s", id)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{2}(:[0-9a-f]{2}){31}$`).MatchString(id.Hex()) {
+		t.Errorf("invalid hex fingerprint %s", id.Hex())
+	}
+}
+
+func TestKeyShare_Sign_keyMismatch(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	docs, _ := batchDocs(t, 1, keyMeta)
+	args := fixedKeyArgs(t)
+	args.R = new(big.Int).Add(args.R, big.NewInt(1))
+	_, otherMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := keyShares[0].Sign(docs[0], keyTestHashType, otherMeta); !errors.Is(err, tcrsa.ErrKeyMismatch) {
+		t.Errorf("signing with other key meta should fail with %v, but it fails with %v", tcrsa.ErrKeyMismatch, err)
+	}
+	if _, err := keyShares[0].SignBatch(docs, keyTestHashType, otherMeta); !errors.Is(err, tcrsa.ErrKeyMismatch) {
+		t.Errorf("batch signing with other key meta should fail with %v, but it fails with %v", tcrsa.ErrKeyMismatch, err)
+	}
+
+	// Key shares without a key id are accepted.
+	keyShare := *keyShares[0]
+	keyShare.KeyID = nil
+	if _, err := keyShare.Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+		t.Errorf("%v", err)
+	}
+}
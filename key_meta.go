@@ -13,6 +13,19 @@ type KeyMeta struct {
 	K               uint16           // Threshold
 	L               uint16           // Total number of participants
 	VerificationKey *VerificationKey // Verification Key associated to a Key Generation.
+	ProofParams     ProofParams      // Parameters of the correctness proofs of the signature shares.
+	Epoch           uint32           // Generation of the key shares, increased every time they are issued again.
+	Participants    []Participant    // Names and weights of the participants. It is empty if the shares are only addressed by id.
+	Mode            SharingMode      // How the private exponent was split into the key shares.
+	Verification    VerificationMode // How the signature shares are verified.
+
+	// Access structure policy of a key created by NewKeyWithPolicy, or empty for k-of-l keys. A policy is a
+	// participant name, or one of the operators thresh(t, p1, ..., pn), and(p1, ..., pn) and or(p1, ..., pn)
+	// applied to other policies. The thresh operator is satisfied by at least t of its policies, and the and and
+	// or operators by all of them and by any of them respectively. The participants are named with letters,
+	// digits and the characters "_.:@-", and every one of them must appear once. It is stored in the canonical
+	// form, which only uses thresh operators, and K is the smallest number of participants that satisfies it.
+	Policy string
 }
 
 // KeyMetaArgs defines the initialization values for key generation.
@@ -24,4 +37,22 @@ type KeyMetaArgs struct {
 	Q *big.Int // Another prime, it should have the other half of the bitsize.
 	R *big.Int // A random prime but it must be coprime with P*Q.
 	U *big.Int // An arbitrary random value.
+
+	ProofParams ProofParams // Parameters of the correctness proofs of the signature shares.
+	Epoch       uint32      // Generation of the key shares.
+	Mode        SharingMode // How the private exponent is split into the key shares. Additive sharing needs k equal to l.
+
+	Verification VerificationMode // How the signature shares are verified.
+
+	// Names of the participants, such as hostnames or UUIDs. If it is not empty, the key shares are assigned to
+	// them in the same order, as many as their weights, so their weights must add up to l. The ids of the key
+	// shares are their evaluation points, so they never change: KeyMeta.RemoveParticipants removes participants
+	// keeping the ids of the others, and participants are added by dealing the key again with Ids set to the ids
+	// of the current participants, so only the new ones are assigned the free ids.
+	Participants []string
+	// Weights of the participants by name. The participants without a weight have weight one.
+	Weights map[string]uint16
+	// Ids of the first key share of the participants by name, such as the ones returned by KeyMeta.Ids. The
+	// participants without an id are assigned the lowest free ids, in order.
+	Ids map[string]uint16
 }
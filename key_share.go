@@ -1,115 +1,349 @@
 package tcrsa
 
 import (
-	"bytes"
 	"crypto"
-	"crypto/sha256"
-	"encoding/base64"
+	"fmt"
 	"math/big"
 )
 
 // KeyShare stores the Si value of a node and an unique incremental ID for the node.
 // It's used to generate a signature share.
 type KeyShare struct {
-	Si []byte // S_i value of the Key Share.
-	Id uint16 // ID of the key share.
+	Si    SecretBytes // S_i value of the Key Share.
+	Id    uint16      // ID of the key share.
+	KeyID KeyID       // Identifier of the key of the share. It is empty in shares created by previous versions of the library.
+	Epoch uint32      // Generation of the key share.
+	Name  string      // Name of the participant of the key share. It is empty if the key has no participant names.
+
+	// Secrets of the tags of the signature shares for every other key share, and MAC keys to check the tags of
+	// the signature shares of every other key share, by id. They are only set for keys with MAC verification.
+	MACSecrets []SecretBytes
+	MACKeys    []MACKey
 }
 
 // KeyShareList is a list of KeyShare values.
 type KeyShareList []*KeyShare
 
-// EqualsSi compares two key share S_i values and returns true if they are equal.
+// EqualsSi compares two key share S_i values in constant time and returns true if they are equal.
 func (keyShare KeyShare) EqualsSi(keyShare2 *KeyShare) bool {
 	if keyShare2 == nil {
 		return false
 	}
-	return bytes.Compare(keyShare.Si, keyShare2.Si) == 0
+	return keyShare.Si.Equal(keyShare2.Si)
 }
 
-// ToBase64 transforms a Si value of a keyshare to Base64, and returns it.
+// ToBase64 returns a redacted text instead of the Si value of the key share.
+//
+// Deprecated: the Si value should be exported explicitly with Si.ExportBase64.
 func (keyShare KeyShare) ToBase64() string {
-	return base64.StdEncoding.EncodeToString(keyShare.Si)
+	return keyShare.Si.String()
+}
+
+// Destroy overwrites the Si value and the MAC secrets and keys of the key share with zeros. The key share cannot
+// be used to sign or verify after that.
+func (keyShare *KeyShare) Destroy() {
+	keyShare.Si.Destroy()
+	for i := range keyShare.MACSecrets {
+		keyShare.MACSecrets[i].Destroy()
+	}
+	for i := range keyShare.MACKeys {
+		keyShare.MACKeys[i].B.Destroy()
+		keyShare.MACKeys[i].C.Destroy()
+	}
+	keyShare.MACSecrets = nil
+	keyShare.MACKeys = nil
 }
 
 // Sign generates a signature share using a key share. A standard RSA signature is generated using several
 // signature shares. The document to be signed should be prepared (hashed and padded) before using this function.
+// The correctness proof of the share uses the ProofVersion1 format, without a context, and the proof parameters
+// of the key meta information. hashType is the hash function of the document, and it is not used by the proof.
+// For keys with MAC verification, the share carries MAC tags instead of a correctness proof.
+// It returns a SigShare with the signature of this node, or an error if the signing process failed.
+func (keyShare KeyShare) Sign(doc []byte, hashType crypto.Hash, info MetaInfo) (sigShare *SigShare, err error) {
+	return keyShare.SignWithContext(doc, hashType, info, nil)
+}
+
+// SignWithContext generates a signature share as Sign, binding its correctness proof to a context provided
+// by the caller, such as a protocol or session identifier. The share is only valid when it is verified
+// with the same context.
 // It returns a SigShare with the signature of this node, or an error if the signing process failed.
-func (keyShare KeyShare) Sign(doc []byte, hashType crypto.Hash, info *KeyMeta) (sigShare *SigShare, err error) {
-
-	x := new(big.Int)
-	xi := new(big.Int)
-	z := new(big.Int)
-	c := new(big.Int)
-	n := new(big.Int)
-	e := new(big.Int)
-	v := new(big.Int)
-	u := new(big.Int)
-	vki := new(big.Int)
+func (keyShare KeyShare) SignWithContext(doc []byte, hashType crypto.Hash, info MetaInfo, context []byte) (sigShare *SigShare, err error) {
+	return keyShare.sign(doc, hashType, info, ProofVersion1, context)
+}
+
+// sign generates a signature share with a correctness proof in the format of the version provided.
+func (keyShare KeyShare) sign(doc []byte, hashType crypto.Hash, info MetaInfo, version uint8, context []byte) (sigShare *SigShare, err error) {
+
 	xTilde := new(big.Int)
 	xi2 := new(big.Int)
-	vPrime := new(big.Int)
-	xPrime := new(big.Int)
-	exp := new(big.Int)
-	si := new(big.Int)
 
-	x.SetBytes(doc)
-	n.Set(info.PublicKey.N)
-	e.SetUint64(uint64(info.PublicKey.E))
-	v.SetBytes(info.VerificationKey.V)
-	u.SetBytes(info.VerificationKey.U)
-	vki.SetBytes(info.VerificationKey.I[keyShare.Id-1])
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return
+	}
+	n := meta.n
+	if keyShare.Id, err = meta.participantId(keyShare.Name, keyShare.Id); err != nil {
+		return
+	}
+	vki, err := meta.verificationKey(keyShare.Id)
+	if err != nil {
+		return
+	}
+	if err = keyShare.checkKey(meta); err != nil {
+		return
+	}
 
-	si.SetBytes(keyShare.Si)
+	si, exp, err := keyShare.secretExponents(meta)
+	if err != nil {
+		return
+	}
+	defer ctWipe(si)
+	defer ctWipe(exp)
 
 	// x = doc if (doc | n) == 1 else doc * u^e
-	if big.Jacobi(x, n) == -1 {
-		ue := new(big.Int).Exp(u, e, n)
-		x.Mul(x, ue).Mod(x, n)
-	}
+	x, _ := meta.adjustDocument(doc)
 	// xi = x^(2*keyShare) mod n
-	exp.Mul(si, big.NewInt(2))
-	xi.Exp(x, exp, n)
+	xi := meta.ctN.exp(x, exp)
+
+	if meta.Verification == MACVerification {
+		if len(context) != 0 {
+			return nil, fmt.Errorf("signature shares with MAC tags do not support a context")
+		}
+		tags, err := keyShare.macTags(meta, x)
+		if err != nil {
+			return nil, err
+		}
+		sigShare = &SigShare{
+			Id:        keyShare.Id,
+			Name:      keyShare.Name,
+			Xi:        xi.Bytes(),
+			Tags:      tags,
+			KeyID:     append(KeyID{}, meta.keyID...),
+			DocDigest: documentDigest(doc),
+			Epoch:     keyShare.Epoch,
+		}
+		return sigShare, nil
+	}
+
 	// x~ = x^4 % n
 	xTilde.Exp(x, big.NewInt(4), n)
 
 	// xi2 = xi^2 % n
 	xi2.Exp(xi, big.NewInt(2), n)
 
-	// r = abs(random(bytes_len))
-	r, err := randInt(n.BitLen() + 2*hashType.Size()*8)
+	// r = nonce(si, statement, random), with enough bits to hide c*si
+	rBits := meta.proof.randomBits(n.BitLen())
+	r, err := keyShare.proofNonce(meta, rBits, []byte(nonceShareLabel), []byte{version}, context, doc)
 	if err != nil {
 		return
 	}
+	defer ctWipe(r)
 
-	// v' = v^r % n
-	vPrime.Exp(v, r, n)
+	// v' = v^r % n, in constant time as r would reveal si
+	vPrime := meta.ctN.exp(meta.v, r)
 
 	// x' = x~^r % n
-	xPrime.Exp(xTilde, r, n)
+	xPrime := meta.ctN.exp(xTilde, r)
 
-	// Hashing all the values
-	sha := sha256.New()
-	sha.Write(v.Bytes())
-	sha.Write(u.Bytes())
-	sha.Write(xTilde.Bytes())
-	sha.Write(vki.Bytes())
-	sha.Write(xi2.Bytes())
-	sha.Write(vPrime.Bytes())
-	sha.Write(xPrime.Bytes())
+	// c = hash(transcript) % n
+	c, err := meta.shareChallenge(version, keyShare.Id, context, &proofValues{
+		xTilde: xTilde,
+		vki:    vki,
+		xi2:    xi2,
+		vPrime: vPrime,
+		xPrime: xPrime,
+	})
+	if err != nil {
+		return
+	}
 
-	hash := sha.Sum(nil)
+	// z = c*si + r
+	z := proofResponse(c, si, r)
 
-	c.SetBytes(hash)
-	c.Mod(c, n)
+	sigShare = &SigShare{
+		Id:        keyShare.Id,
+		Name:      keyShare.Name,
+		Version:   version,
+		Xi:        xi.Bytes(),
+		C:         c.Bytes(),
+		Z:         z.Bytes(),
+		KeyID:     append(KeyID{}, meta.keyID...),
+		DocDigest: documentDigest(doc),
+		Epoch:     keyShare.Epoch,
+		V:         vPrime.Bytes(),
+		X:         xPrime.Bytes(),
+	}
+	return
+}
 
-	z.Mul(c, si)
-	z.Add(z, r)
+// SignBatch generates the signature shares of a node for several documents at once. As Sign, the
+// documents should be prepared (hashed and padded) before using this function.
+// Instead of one correctness proof per document, the shares are aggregated with random weights
+// derived from all of them and a single proof is generated for the whole batch, using the proof parameters of
+// the key meta information.
+// It returns a BatchSigShare with the signature shares of this node, or an error if the signing process failed.
+func (keyShare KeyShare) SignBatch(docs [][]byte, hashType crypto.Hash, info MetaInfo) (batch *BatchSigShare, err error) {
+	if len(docs) == 0 {
+		err = fmt.Errorf("there are no documents to sign")
+		return
+	}
 
-	sigShare = &SigShare{
-		Id: keyShare.Id,
-		Xi: xi.Bytes(),
-		C:  c.Bytes(),
-		Z:  z.Bytes(),
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return
+	}
+	if meta.Verification != ProofVerification {
+		err = fmt.Errorf("batch signature shares cannot be generated for keys with %s verification", meta.Verification)
+		return
+	}
+	n := meta.n
+	if keyShare.Id, err = meta.participantId(keyShare.Name, keyShare.Id); err != nil {
+		return
+	}
+	vki, err := meta.verificationKey(keyShare.Id)
+	if err != nil {
+		return
+	}
+	if err = keyShare.checkKey(meta); err != nil {
+		return
+	}
+
+	si, exp, err := keyShare.secretExponents(meta)
+	if err != nil {
+		return
+	}
+	defer ctWipe(si)
+	defer ctWipe(exp)
+
+	xTildes := make([]*big.Int, len(docs))
+	xi2s := make([]*big.Int, len(docs))
+
+	batch = &BatchSigShare{
+		Id:         keyShare.Id,
+		Name:       keyShare.Name,
+		Version:    ProofVersion1,
+		Xi:         make([][]byte, len(docs)),
+		KeyID:      append(KeyID{}, meta.keyID...),
+		Epoch:      keyShare.Epoch,
+		DocDigests: make([][]byte, len(docs)),
+	}
+
+	for j, doc := range docs {
+		// x = doc if (doc | n) == 1 else doc * u^e
+		x, _ := meta.adjustDocument(doc)
+		// xi = x^(2*keyShare) mod n
+		xi := meta.ctN.exp(x, exp)
+		// x~ = x^4 % n
+		xTildes[j] = x.Exp(x, big.NewInt(4), n)
+		// xi2 = xi^2 % n
+		xi2s[j] = new(big.Int).Exp(xi, big.NewInt(2), n)
+		batch.Xi[j] = xi.Bytes()
+		batch.DocDigests[j] = documentDigest(doc)
+	}
+
+	// X = prod(x~_j^a_j) and Xi = prod(xi2_j^a_j) = X^si
+	xTilde, xi2, err := meta.batchAggregate(batch.Version, vki, batch.DocDigests, xTildes, xi2s)
+	if err != nil {
+		return
+	}
+
+	// r = nonce(si, statement, random), with enough bits to hide c*si
+	rBits := meta.proof.randomBits(n.BitLen())
+	r, err := keyShare.proofNonce(meta, rBits, append([][]byte{[]byte(nonceBatchLabel)}, docs...)...)
+	if err != nil {
+		return
+	}
+	defer ctWipe(r)
+
+	// v' = v^r % n, in constant time as r would reveal si
+	vPrime := meta.ctN.exp(meta.v, r)
+
+	// X' = X^r % n
+	xPrime := meta.ctN.exp(xTilde, r)
+
+	c, err := meta.batchChallenge(batch.Version, batch.Id, batch.Epoch, xTilde, vki, xi2, vPrime, xPrime)
+	if err != nil {
+		return
 	}
+
+	// z = c*si + r
+	z := proofResponse(c, si, r)
+
+	batch.C = c.Bytes()
+	batch.Z = z.Bytes()
+	return
+}
+
+// checkKey checks that the key share belongs to the key of the key meta information, if it records its key,
+// and to its epoch.
+// It returns an error wrapping ErrKeyMismatch or ErrEpochMismatch if it does not.
+func (keyShare KeyShare) checkKey(meta *PreparedKeyMeta) error {
+	if len(keyShare.KeyID) != 0 && !keyShare.KeyID.Equal(meta.keyID) {
+		return fmt.Errorf("key share with id %d: %w", keyShare.Id, ErrKeyMismatch)
+	}
+	if keyShare.Epoch != meta.Epoch {
+		return fmt.Errorf("key share with id %d has epoch %d, but the key has epoch %d: %w", keyShare.Id, keyShare.Epoch, meta.Epoch, ErrEpochMismatch)
+	}
+	return nil
+}
+
+// secretExponents returns the S_i value of the key share and two times it as fixed-width numbers, with the
+// limbs of the modulus and one more limb respectively, to be used in constant-time operations.
+// It returns an error if S_i is larger than the modulus.
+func (keyShare KeyShare) secretExponents(meta *PreparedKeyMeta) (si, exp []uint64, err error) {
+	limbs := len(meta.ctN.m)
+	si, err = ctLimbsFromBytes(keyShare.Si, limbs)
+	if err != nil {
+		err = fmt.Errorf("invalid key share: %v", err)
+		return
+	}
+	exp = ctMulAdd(si, []uint64{2}, nil, limbs+1)
 	return
 }
+
+// proofResponse returns z = c*si + r, computing it in constant time with fixed-width numbers. c should be
+// lower than the modulus and si should have its limbs.
+func proofResponse(c *big.Int, si []uint64, r []uint64) *big.Int {
+	limbs := len(si)
+	zLimbs := len(r)
+	if 2*limbs > zLimbs {
+		zLimbs = 2 * limbs
+	}
+	return ctLimbsToBig(ctMulAdd(ctLimbsFromBig(c, limbs), si, r, zLimbs+1))
+}
+
+// Participant returns the key shares of the list which belong to the participant with the name provided.
+func (keyShareList KeyShareList) Participant(name string) KeyShareList {
+	var shares KeyShareList
+	for _, keyShare := range keyShareList {
+		if keyShare != nil && keyShare.Name == name {
+			shares = append(shares, keyShare)
+		}
+	}
+	return shares
+}
+
+// Sign generates the signature shares of all the key shares of the list, which are usually the key shares of a
+// weighted participant. As KeyShare.Sign, the document should be prepared (hashed and padded) before using this
+// function.
+// It returns the signature shares in the same order, or an error if any of them could not be generated.
+func (keyShareList KeyShareList) Sign(doc []byte, hashType crypto.Hash, info MetaInfo) (SigShareList, error) {
+	if len(keyShareList) == 0 {
+		return nil, fmt.Errorf("there are no key shares to sign with")
+	}
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	sigShares := make(SigShareList, len(keyShareList))
+	for i, keyShare := range keyShareList {
+		if keyShare == nil {
+			return nil, fmt.Errorf("key share %d is nil", i)
+		}
+		if sigShares[i], err = keyShare.Sign(doc, hashType, meta); err != nil {
+			return nil, err
+		}
+	}
+	return sigShares, nil
+}
@@ -0,0 +1,139 @@
+package tcrsa
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// Maximum number of signer subsets whose join coefficients are cached in a PreparedKeyMeta.
+const lagrangeCacheSize = 256
+
+// joinCoefficients stores the exponents used to join the signature shares of a subset of signers.
+// Instead of multiplying the lagrange coefficients by delta = l!, they are multiplied by the smallest integer
+// d that makes them integers, which is usually much smaller, and the remaining delta/d factor is applied once
+// to the product of the shares. Policy and additive keys use their own exponents.
+type joinCoefficients struct {
+	lambdas2 map[uint16]*big.Int // Two times d times the lagrange coefficient in 0 of each signer.
+	tA       *big.Int            // (delta/d) * a, where a and b satisfy 4*a + e*b = 1.
+	b        *big.Int            //
+}
+
+// lagrangeCoefficients returns the lagrange coefficients in x of the points with the ids provided, as the
+// integers mu_i = d * L_i(x), where d is the smallest positive integer that makes all of them integers.
+// It returns an error if the ids are repeated.
+func lagrangeCoefficients(ids []int64, x int64) (mus []*big.Int, d *big.Int, err error) {
+	nums := make([]*big.Int, len(ids))
+	dens := make([]*big.Int, len(ids))
+	d = big.NewInt(1)
+	g := new(big.Int)
+	for i, id := range ids {
+		num := big.NewInt(1)
+		den := big.NewInt(1)
+		for j, idJ := range ids {
+			if j == i {
+				continue
+			}
+			if idJ == id {
+				return nil, nil, fmt.Errorf("there is more than one share with id %d", id)
+			}
+			num.Mul(num, big.NewInt(x-idJ))  // num <-- num*(x-id_j)
+			den.Mul(den, big.NewInt(id-idJ)) // den <-- den*(id-id_j)
+		}
+		if den.Sign() < 0 {
+			num.Neg(num)
+			den.Neg(den)
+		}
+		g.GCD(nil, nil, new(big.Int).Abs(num), den)
+		nums[i] = num.Quo(num, g)
+		dens[i] = den.Quo(den, g)
+		// d = lcm(d, den)
+		g.GCD(nil, nil, d, dens[i])
+		d.Mul(d, g.Quo(dens[i], g))
+	}
+	mus = make([]*big.Int, len(ids))
+	for i := range mus {
+		mus[i] = new(big.Int).Quo(d, dens[i])
+		mus[i].Mul(mus[i], nums[i])
+	}
+	return mus, d, nil
+}
+
+// joinCoefficients returns the coefficients to join the shares of the signers with the ids provided, using the
+// policy or the sharing mode of the key. The coefficients of the last subsets are cached, so they are computed only
+// once for repeated signer subsets.
+func (prepared *PreparedKeyMeta) joinCoefficients(ids []uint16) (*joinCoefficients, error) {
+	sorted := make([]uint16, len(ids))
+	copy(sorted, ids)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	key := make([]byte, 2*len(sorted))
+	for i, id := range sorted {
+		binary.BigEndian.PutUint16(key[2*i:], id)
+	}
+
+	prepared.lagrangeMutex.Lock()
+	coefficients, ok := prepared.lagrangeCache[string(key)]
+	prepared.lagrangeMutex.Unlock()
+	if ok {
+		return coefficients, nil
+	}
+	if prepared.policy != nil || prepared.Mode == AdditiveSharing {
+		var err error
+		if prepared.policy != nil {
+			coefficients, err = prepared.policyJoinCoefficients(sorted)
+		} else {
+			coefficients, err = prepared.additiveJoinCoefficients(sorted)
+		}
+		if err != nil {
+			return nil, err
+		}
+		prepared.cacheJoinCoefficients(string(key), coefficients)
+		return coefficients, nil
+	}
+
+	points := make([]int64, len(sorted))
+	for i, id := range sorted {
+		if id < 1 || id > prepared.L {
+			return nil, fmt.Errorf("id should be between 1 and %d, but it is %d", prepared.L, id)
+		}
+		points[i] = int64(id)
+	}
+	mus, d, err := lagrangeCoefficients(points, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// delta/d is an integer, because delta times any lagrange coefficient of ids lower or equal than l is an integer.
+	delta := new(big.Int).MulRange(1, int64(prepared.L))
+	t, rem := new(big.Int).QuoRem(delta, d, new(big.Int))
+	if rem.Sign() != 0 {
+		return nil, fmt.Errorf("lagrange coefficients denominator does not divide l!")
+	}
+
+	coefficients = &joinCoefficients{
+		lambdas2: make(map[uint16]*big.Int, len(sorted)),
+		tA:       new(big.Int),
+		b:        new(big.Int),
+	}
+	new(big.Int).GCD(coefficients.tA, coefficients.b, big.NewInt(4), prepared.e)
+	coefficients.tA.Mul(coefficients.tA, t)
+	for i, id := range sorted {
+		coefficients.lambdas2[id] = mus[i].Lsh(mus[i], 1)
+	}
+	prepared.cacheJoinCoefficients(string(key), coefficients)
+	return coefficients, nil
+}
+
+// cacheJoinCoefficients stores the join coefficients of a signer subset in the cache, emptying it when it is full.
+func (prepared *PreparedKeyMeta) cacheJoinCoefficients(key string, coefficients *joinCoefficients) {
+	prepared.lagrangeMutex.Lock()
+	if len(prepared.lagrangeCache) >= lagrangeCacheSize {
+		prepared.lagrangeCache = nil
+	}
+	if prepared.lagrangeCache == nil {
+		prepared.lagrangeCache = make(map[string]*joinCoefficients)
+	}
+	prepared.lagrangeCache[key] = coefficients
+	prepared.lagrangeMutex.Unlock()
+}
@@ -0,0 +1,58 @@
+package tcrsa
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestLagrangeCoefficients(t *testing.T) {
+	// The coefficients in 0 of 1..5 are integers, so d is 1.
+	mus, d, err := lagrangeCoefficients([]int64{1, 2, 3, 4, 5}, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []int64{5, -10, 10, -5, 1}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("d is %s, but it should be 1", d)
+	}
+	for i := range mus {
+		if mus[i].Cmp(big.NewInt(expected[i])) != 0 {
+			t.Errorf("coefficient %d is %s, but it should be %d", i, mus[i], expected[i])
+		}
+	}
+
+	// For 2, 4 and 5, L_2(0) = 10/3, L_4(0) = -5 and L_5(0) = 8/3.
+	mus, d, err = lagrangeCoefficients([]int64{2, 4, 5}, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected = []int64{10, -15, 8}
+	if d.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("d is %s, but it should be 3", d)
+	}
+	for i := range mus {
+		if mus[i].Cmp(big.NewInt(expected[i])) != 0 {
+			t.Errorf("coefficient %d is %s, but it should be %d", i, mus[i], expected[i])
+		}
+	}
+
+	if _, _, err := lagrangeCoefficients([]int64{1, 2, 2}, 0); err == nil {
+		t.Errorf("repeated ids should fail")
+	}
+}
+
+func TestLagrangeCoefficients_delta(t *testing.T) {
+	// delta = 5! times the coefficients in 0 of 1..5, as they were computed before d was introduced.
+	expected := []int64{600, -1200, 1200, -600, 120}
+	mus, d, err := lagrangeCoefficients([]int64{1, 2, 3, 4, 5}, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	delta := new(big.Int).MulRange(1, 5)
+	factor := new(big.Int).Quo(delta, d)
+	for i := range mus {
+		if scaled := new(big.Int).Mul(mus[i], factor); scaled.Cmp(big.NewInt(expected[i])) != 0 {
+			t.Errorf("coefficient %d times delta is %s, but it should be %d", i+1, scaled, expected[i])
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package tcrsa
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// VerificationMode defines how the signature shares of a key are verified.
+type VerificationMode uint8
+
+const (
+	// ProofVerification adds a correctness proof to every signature share, which anyone with the key meta
+	// information can verify. It is the default mode.
+	ProofVerification VerificationMode = iota
+	// MACVerification adds information checking tags to every signature share instead of a correctness proof,
+	// as in the RSA information checking protocol of Gennaro, Jarecki, Krawczyk and Rabin. The dealer gives
+	// every pair of key shares a secret MAC key, so the tags are cheaper to compute than a proof and do not use
+	// a challenge hash, but only the holders of the other key shares can verify them, with
+	// KeyShare.VerifySigShare. It is meant for closed deployments with a trusted dealer.
+	MACVerification
+)
+
+// String returns the name of the verification mode.
+func (mode VerificationMode) String() string {
+	switch mode {
+	case ProofVerification:
+		return "proof"
+	case MACVerification:
+		return "mac"
+	default:
+		return fmt.Sprintf("VerificationMode(%d)", uint8(mode))
+	}
+}
+
+// checkVerificationMode returns an error if the verification mode is unknown.
+func checkVerificationMode(mode VerificationMode) error {
+	if mode > MACVerification {
+		return fmt.Errorf("unknown verification mode %d", mode)
+	}
+	return nil
+}
+
+// checkProofVerification returns an error if the signature shares of the key cannot be verified with their
+// correctness proofs, because they carry MAC tags instead.
+func (prepared *PreparedKeyMeta) checkProofVerification() error {
+	if prepared.Verification != ProofVerification {
+		return fmt.Errorf("signature shares of keys with %s verification should be verified with KeyShare.VerifySigShare", prepared.Verification)
+	}
+	return nil
+}
+
+// MACKey is the secret key that a key share holds to check the tags of the signature shares of another key share.
+// The other key share holds a secret y, and the dealer chooses a random B and computes C = B * S_i + y, so a
+// valid signature share x^(2*S_i) with tag x^(2*y) satisfies (x^(2*S_i))^B * x^(2*y) = x^(2*C).
+type MACKey struct {
+	B SecretBytes // Random multiplier, with as many bits as the challenges of the proof parameters of the key.
+	C SecretBytes // B * S_i + y, where S_i is the value of the other key share and y is its tag secret.
+}
+
+// dealMACs creates the MAC keys and the tag secrets of every pair of key shares, which should have their S_i
+// values set. The tag secrets have enough bits to hide B * S_i with the hiding parameter of the proofs.
+// It returns an error if the random values cannot be generated.
+func dealMACs(shares KeyShareList, proof ProofParams, nBits int) error {
+	for _, keyShare := range shares {
+		keyShare.MACSecrets = make([]SecretBytes, len(shares))
+		keyShare.MACKeys = make([]MACKey, len(shares))
+	}
+	bMax := new(big.Int).Lsh(big.NewInt(1), uint(proof.ChallengeBits))
+	yMax := new(big.Int).Lsh(big.NewInt(1), uint(proof.randomBits(nBits)))
+	si := new(big.Int)
+	c := new(big.Int)
+	defer wipeInts(si, c)
+	for i, signer := range shares {
+		si.SetBytes(signer.Si)
+		for j, verifier := range shares {
+			if i == j {
+				continue
+			}
+			b, err := rand.Int(rand.Reader, bMax)
+			if err != nil {
+				return err
+			}
+			y, err := rand.Int(rand.Reader, yMax)
+			if err != nil {
+				return err
+			}
+			// c = b*si + y
+			c.Mul(b, si).Add(c, y)
+			signer.MACSecrets[j] = y.Bytes()
+			verifier.MACKeys[i] = MACKey{B: b.Bytes(), C: c.Bytes()}
+			wipeInts(b, y)
+		}
+	}
+	return nil
+}
+
+// macTags returns the tags of the signature share of the key share for the document number x, one for every
+// other key share, by id. The tag for a verifier is x^(2*y), where y is the tag secret for it.
+// It returns an error if the key share has no tag secrets for all the key shares of the key.
+func (keyShare KeyShare) macTags(meta *PreparedKeyMeta, x *big.Int) ([][]byte, error) {
+	if len(keyShare.MACSecrets) != int(meta.L) {
+		return nil, fmt.Errorf("key share with id %d has %d tag secrets, but it should have %d", keyShare.Id, len(keyShare.MACSecrets), meta.L)
+	}
+	limbs := ctLimbsLen(meta.proof.randomBits(meta.n.BitLen()))
+	tags := make([][]byte, meta.L)
+	for j, secret := range keyShare.MACSecrets {
+		if j == int(keyShare.Id)-1 {
+			continue
+		}
+		y, err := ctLimbsFromBytes(secret, limbs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag secret for id %d: %v", j+1, err)
+		}
+		exp := ctMulAdd(y, []uint64{2}, nil, limbs+1)
+		// tag = x^(2*y) mod n
+		tags[j] = meta.ctN.exp(x, exp).Bytes()
+		ctWipe(y)
+		ctWipe(exp)
+	}
+	return tags, nil
+}
+
+// VerifySigShare verifies with the MAC key of the key share that a signature share of a key with MAC verification
+// was generated by another key share of the same key for the document provided. Signature shares of keys with
+// MAC verification can only be verified this way, by the holders of the other key shares.
+// It returns nil if the signature share is valid, and an error if it is not.
+func (keyShare KeyShare) VerifySigShare(sigShare *SigShare, doc []byte, info MetaInfo) error {
+	if sigShare == nil {
+		return fmt.Errorf("signature share is nil")
+	}
+	if doc == nil {
+		return fmt.Errorf("document is nil")
+	}
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return err
+	}
+	if meta.Verification != MACVerification {
+		return fmt.Errorf("signature shares of keys with %s verification should be verified with SigShare.Verify", meta.Verification)
+	}
+	if keyShare.Id, err = meta.participantId(keyShare.Name, keyShare.Id); err != nil {
+		return err
+	}
+	if err := keyShare.checkKey(meta); err != nil {
+		return err
+	}
+	id, err := meta.participantId(sigShare.Name, sigShare.Id)
+	if err != nil {
+		return err
+	}
+	if err := sigShare.checkBinding(meta, documentDigest(doc)); err != nil {
+		return err
+	}
+	if id < 1 || id > meta.L {
+		return fmt.Errorf("id should be between 1 and %d, but it is %d", meta.L, id)
+	}
+	if id == keyShare.Id {
+		return fmt.Errorf("key share with id %d cannot verify its own signature shares", id)
+	}
+	if len(keyShare.MACKeys) != int(meta.L) {
+		return fmt.Errorf("key share with id %d has %d MAC keys, but it should have %d", keyShare.Id, len(keyShare.MACKeys), meta.L)
+	}
+	if len(sigShare.Tags) != int(meta.L) {
+		return fmt.Errorf("signature share with id %d has %d tags, but it should have %d", id, len(sigShare.Tags), meta.L)
+	}
+
+	n := meta.n
+	xi := new(big.Int).SetBytes(sigShare.Xi)
+	tag := new(big.Int).SetBytes(sigShare.Tags[keyShare.Id-1])
+	if xi.Sign() == 0 || xi.Cmp(n) >= 0 || tag.Sign() == 0 || tag.Cmp(n) >= 0 {
+		return fmt.Errorf("invalid signature share with id %d", id)
+	}
+
+	key := keyShare.MACKeys[id-1]
+	bLimbs := ctLimbsLen(meta.proof.ChallengeBits)
+	cLimbs := ctLimbsLen(meta.proof.randomBits(n.BitLen()) + 1)
+	b, err := ctLimbsFromBytes(key.B, bLimbs)
+	if err != nil {
+		return fmt.Errorf("invalid MAC key for id %d: %v", id, err)
+	}
+	defer ctWipe(b)
+	c, err := ctLimbsFromBytes(key.C, cLimbs)
+	if err != nil {
+		return fmt.Errorf("invalid MAC key for id %d: %v", id, err)
+	}
+	defer ctWipe(c)
+
+	// The values are squared, so the share and the tag can only be changed together by a factor of order 2
+	// that does not change the signature.
+	// left = (xi^b * tag)^2 = xi^(2*b) * tag^2
+	b2 := ctMulAdd(b, []uint64{2}, nil, bLimbs+1)
+	defer ctWipe(b2)
+	left := meta.ctN.exp(xi, b2)
+	tag.Exp(tag, big.NewInt(2), n)
+	left.Mul(left, tag).Mod(left, n)
+
+	// right = x^(4*c)
+	x, _ := meta.adjustDocument(doc)
+	c4 := ctMulAdd(c, []uint64{4}, nil, cLimbs+1)
+	defer ctWipe(c4)
+	right := meta.ctN.exp(x, c4)
+
+	if left.Cmp(right) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid signature share with id %d", id)
+}
@@ -0,0 +1,99 @@
+package tcrsa_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"github.com/niclabs/tcrsa"
+	"math/big"
+	"testing"
+)
+
+func TestNewKey_macVerification(t *testing.T) {
+	args := fixedKeyArgs(t)
+	args.Verification = tcrsa.MACVerification
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	docs, hashes := batchDocs(t, 2, keyMeta)
+	sigShares := make(tcrsa.SigShareList, len(keyShares))
+	for i, keyShare := range keyShares {
+		if sigShares[i], err = keyShare.Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(sigShares[i].C) != 0 || len(sigShares[i].Z) != 0 || len(sigShares[i].Tags) != keyTestL {
+			t.Errorf("signature share %d should carry %d tags and no proof", sigShares[i].Id, keyTestL)
+		}
+	}
+
+	for _, verifier := range keyShares {
+		for _, sigShare := range sigShares {
+			err := verifier.VerifySigShare(sigShare, docs[0], keyMeta)
+			if sigShare.Id == verifier.Id {
+				if err == nil {
+					t.Errorf("key share %d should not verify its own signature share", verifier.Id)
+				}
+			} else if err != nil {
+				t.Errorf("key share %d should verify signature share %d: %v", verifier.Id, sigShare.Id, err)
+			}
+		}
+	}
+
+	signature, err := sigShares.Join(docs[0], keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, hashes[0], signature); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	// The signature share of the second key share, checked by the first one.
+	verifier := keyShares[0]
+	forged := *sigShares[1]
+	xi := new(big.Int).SetBytes(forged.Xi)
+	forged.Xi = xi.Mul(xi, big.NewInt(2)).Mod(xi, keyMeta.PublicKey.N).Bytes()
+	if err := verifier.VerifySigShare(&forged, docs[0], keyMeta); err == nil {
+		t.Errorf("signature share with a modified value should be invalid")
+	}
+	forged = *sigShares[1]
+	forged.Tags = append([][]byte{}, forged.Tags...)
+	forged.Tags[0] = sigShares[1].Tags[2]
+	if err := verifier.VerifySigShare(&forged, docs[0], keyMeta); err == nil {
+		t.Errorf("signature share with the tag of another verifier should be invalid")
+	}
+	forged = *sigShares[1]
+	forged.DocDigest = nil
+	if err := verifier.VerifySigShare(&forged, docs[1], keyMeta); err == nil {
+		t.Errorf("signature share should be invalid for another document")
+	}
+
+	if err := sigShares[1].Verify(docs[0], keyMeta); err == nil {
+		t.Errorf("signature shares with tags should not be verified with a proof")
+	}
+	if _, err := sigShares.VerifyParallel(docs[0], keyMeta, 0); err == nil {
+		t.Errorf("signature shares with tags should not be verified with a proof")
+	}
+	if _, err := verifier.SignBatch(docs, keyTestHashType, keyMeta); err == nil {
+		t.Errorf("batch signature shares should not be generated for keys with MAC verification")
+	}
+	if _, err := verifier.SignWithContext(docs[0], keyTestHashType, keyMeta, []byte("context")); err == nil {
+		t.Errorf("signature shares with tags should not be bound to a context")
+	}
+
+	verifier.Destroy()
+	if verifier.MACKeys != nil || verifier.MACSecrets != nil {
+		t.Errorf("MAC keys and secrets should be destroyed")
+	}
+}
+
+func TestKeyShare_VerifySigShareWithProof(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	docs, _ := batchDocs(t, 1, keyMeta)
+	sigShare, err := keyShares[1].Sign(docs[0], keyTestHashType, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := keyShares[0].VerifySigShare(sigShare, docs[0], keyMeta); err == nil {
+		t.Errorf("signature shares with a proof should not be verified with a MAC key")
+	}
+}
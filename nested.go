@@ -0,0 +1,635 @@
+package tcrsa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// Maximum number of custodians of a sub-shared key share. Every custodian holds one piece for each set of t-1
+// other custodians, so the number of pieces grows quickly with the number of custodians.
+const maxCustodians = 16
+
+// Domain separation tag of the hashes of the sub-share commitments.
+const subCommitmentTag = "tcrsa/sub-commitment/v1"
+
+// SubShare is the part of a key share held by one of its custodians, created by KeyShare.SubShare. The S_i value
+// of the key share is split into integer pieces, one for every set of t-1 custodians, and every custodian holds
+// the pieces of the sets it does not belong to, so any t custodians hold all the pieces between them and fewer
+// custodians miss at least one. A quorum of custodians produces the signature share of the key share in three
+// rounds, with SubShare.Commit, SubShare.Reveal and SubShare.Respond, and JoinSubShares combines their messages
+// into a SigShare that verifies against the verification value of the key share, so the key meta information and
+// the other participants do not need to know about the nesting.
+type SubShare struct {
+	Id         uint16 // ID of the key share.
+	Name       string // Name of the participant of the key share, if the key has participant names.
+	KeyID      KeyID  // Identifier of the key of the key share.
+	Epoch      uint32 // Generation of the key share.
+	Custodian  uint16 // ID of the custodian, between 1 and Custodians.
+	Threshold  uint16 // Number of custodians needed to produce a signature share.
+	Custodians uint16 // Total number of custodians.
+	// Pieces of S_i by set of t-1 custodians, in lexicographic order of the sets. The pieces of the sets that the
+	// custodian belongs to are empty.
+	Pieces []SecretBytes
+	// Public offset D, such that the sum of all the pieces is S_i + D. It lets all the pieces be positive.
+	Offset []byte
+}
+
+// SubCommitmentHash is the message of a custodian in the first round of the signing protocol of a sub-shared key
+// share. It binds the custodian to its SubCommitment before it sees the commitments of the others, so the last
+// custodian to reveal its commitment cannot choose it to manipulate the joint challenge.
+type SubCommitmentHash struct {
+	Custodian uint16 // ID of the custodian.
+	Hash      []byte // SHA-256 hash of the commitment of the custodian.
+}
+
+// SubCommitment is the message of a custodian in the second round of the signing protocol of a sub-shared key
+// share, which commits it to the random value of its part of the correctness proof.
+type SubCommitment struct {
+	Id        uint16   // ID of the key share.
+	Name      string   // Name of the participant of the key share.
+	Custodian uint16   // ID of the custodian.
+	Quorum    []uint16 // IDs of the custodians of the signing quorum, in increasing order.
+	Xi        []byte   // Part of the signature share computed with the pieces of the custodian.
+	V         []byte   // v^r, where r is the random value of the custodian.
+	X         []byte   // x~^r, where x~ is the fourth power of the document.
+	Offset    []byte   // Offset D of the sub-shares.
+	KeyID     KeyID    // Identifier of the key.
+	DocDigest []byte   // SHA-256 digest of the prepared document.
+	Epoch     uint32   // Generation of the key share.
+}
+
+// SubResponse is the message of a custodian in the third round of the signing protocol of a sub-shared key
+// share, with its part of the response of the correctness proof.
+type SubResponse struct {
+	Custodian uint16 // ID of the custodian.
+	Z         []byte // c*s + r, where s is the sum of the pieces used by the custodian.
+}
+
+// SubNonce is the secret state that a custodian keeps between the rounds of the signing protocol. It can be used
+// only once, as two responses with the same random value reveal the pieces of the custodian.
+type SubNonce struct {
+	custodian  uint16
+	quorum     []uint16
+	docDigest  []byte
+	commitment *SubCommitment    // Commitment of the custodian, kept until all the hashes are received.
+	hashes     map[uint16][]byte // Hashes of the commitments of the quorum by custodian, once revealed.
+	r          []uint64
+}
+
+// Destroy overwrites the random value of the nonce with zeros. The nonce cannot be used after that.
+func (nonce *SubNonce) Destroy() {
+	if nonce == nil || nonce.r == nil {
+		return
+	}
+	ctWipe(nonce.r)
+	nonce.r = nil
+}
+
+// Destroy overwrites the pieces of the sub-share with zeros.
+func (subShare *SubShare) Destroy() {
+	for i := range subShare.Pieces {
+		subShare.Pieces[i].Destroy()
+	}
+	subShare.Pieces = nil
+}
+
+// custodianSets returns all the sets of size custodians out of 1..c, in lexicographic order.
+func custodianSets(c, size int) [][]uint16 {
+	var sets [][]uint16
+	set := make([]uint16, 0, size)
+	var walk func(next int)
+	walk = func(next int) {
+		if len(set) == size {
+			sets = append(sets, append([]uint16{}, set...))
+			return
+		}
+		for i := next; i <= c-(size-len(set))+1; i++ {
+			set = append(set, uint16(i))
+			walk(i + 1)
+			set = set[:len(set)-1]
+		}
+	}
+	walk(1)
+	return sets
+}
+
+// containsCustodian returns true if the set contains the custodian.
+func containsCustodian(set []uint16, custodian uint16) bool {
+	for _, member := range set {
+		if member == custodian {
+			return true
+		}
+	}
+	return false
+}
+
+// pieceBits returns the bit length of the pieces of a sub-shared key share, which hide S_i with the hiding
+// parameter of the proofs.
+func (prepared *PreparedKeyMeta) pieceBits() int {
+	return prepared.n.BitLen() + prepared.proof.HidingBits
+}
+
+// SubShare splits the S_i value of the key share among custodians, so any threshold of them can produce its
+// signature shares together, and fewer of them learn nothing about it. It is only supported for keys whose
+// signature shares are verified with correctness proofs.
+// It returns the sub-shares of the custodians, by id, or an error if the parameters are invalid or the key share
+// does not belong to the key.
+func (keyShare KeyShare) SubShare(threshold, custodians uint16, info MetaInfo) ([]*SubShare, error) {
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	if err := meta.checkProofVerification(); err != nil {
+		return nil, err
+	}
+	if custodians < 2 || custodians > maxCustodians {
+		return nil, fmt.Errorf("custodians should be between 2 and %d, but they are %d", maxCustodians, custodians)
+	}
+	if threshold < 1 || threshold > custodians {
+		return nil, fmt.Errorf("threshold should be between 1 and %d, but it is %d", custodians, threshold)
+	}
+	if keyShare.Id, err = meta.participantId(keyShare.Name, keyShare.Id); err != nil {
+		return nil, err
+	}
+	if _, err := meta.verificationKey(keyShare.Id); err != nil {
+		return nil, err
+	}
+	if err := keyShare.checkKey(meta); err != nil {
+		return nil, err
+	}
+
+	sets := custodianSets(int(custodians), int(threshold)-1)
+	bits := meta.pieceBits()
+	pieceMax := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	// D = (pieces-1) * 2^bits, so the first piece S_i + D - sum(other pieces) is positive.
+	offset := new(big.Int).Mul(big.NewInt(int64(len(sets)-1)), pieceMax)
+	pieces := make([]*big.Int, len(sets))
+	first := new(big.Int).SetBytes(keyShare.Si)
+	first.Add(first, offset)
+	defer func() {
+		wipeInts(pieces...)
+		wipeInts(first)
+	}()
+	for k := 1; k < len(pieces); k++ {
+		if pieces[k], err = rand.Int(rand.Reader, pieceMax); err != nil {
+			return nil, err
+		}
+		first.Sub(first, pieces[k])
+	}
+	pieces[0] = first
+
+	subShares := make([]*SubShare, custodians)
+	for j := range subShares {
+		custodian := uint16(j + 1)
+		subShare := &SubShare{
+			Id:         keyShare.Id,
+			Name:       keyShare.Name,
+			KeyID:      append(KeyID{}, meta.keyID...),
+			Epoch:      keyShare.Epoch,
+			Custodian:  custodian,
+			Threshold:  threshold,
+			Custodians: custodians,
+			Pieces:     make([]SecretBytes, len(sets)),
+			Offset:     offset.Bytes(),
+		}
+		for k, set := range sets {
+			if !containsCustodian(set, custodian) {
+				subShare.Pieces[k] = pieces[k].Bytes()
+			}
+		}
+		subShares[j] = subShare
+	}
+	return subShares, nil
+}
+
+// checkQuorum checks that the quorum has at least the threshold of custodians of the sub-share, in increasing
+// order and including the custodian of the sub-share.
+func (subShare SubShare) checkQuorum(quorum []uint16) error {
+	if len(quorum) < int(subShare.Threshold) {
+		return fmt.Errorf("quorum has %d custodians, but it should have at least %d", len(quorum), subShare.Threshold)
+	}
+	for i, custodian := range quorum {
+		if custodian < 1 || custodian > subShare.Custodians {
+			return fmt.Errorf("custodian should be between 1 and %d, but it is %d", subShare.Custodians, custodian)
+		}
+		if i > 0 && custodian <= quorum[i-1] {
+			return fmt.Errorf("quorum custodians should be in increasing order and not repeated")
+		}
+	}
+	if !containsCustodian(quorum, subShare.Custodian) {
+		return fmt.Errorf("custodian %d is not in the quorum", subShare.Custodian)
+	}
+	return nil
+}
+
+// secretSum returns the sum of the pieces that the custodian of the sub-share uses with the quorum provided, as
+// a fixed-width number to be used in constant-time operations, and its maximum bit length. Every piece is used by
+// the first custodian of the quorum that holds it.
+// It returns an error if the sub-share does not hold a piece it should use.
+func (subShare SubShare) secretSum(quorum []uint16, meta *PreparedKeyMeta) (s []uint64, bits int, err error) {
+	sets := custodianSets(int(subShare.Custodians), int(subShare.Threshold)-1)
+	if len(subShare.Pieces) != len(sets) {
+		return nil, 0, fmt.Errorf("sub-share has %d pieces, but it should have %d", len(subShare.Pieces), len(sets))
+	}
+	bits = meta.pieceBits() + big.NewInt(int64(len(sets))).BitLen()
+	limbs := ctLimbsLen(bits)
+	s = make([]uint64, limbs)
+	one := []uint64{1}
+	for k, set := range sets {
+		var owner uint16
+		for _, custodian := range quorum {
+			if !containsCustodian(set, custodian) {
+				owner = custodian
+				break
+			}
+		}
+		if owner != subShare.Custodian {
+			continue
+		}
+		piece, err := ctLimbsFromBytes(subShare.Pieces[k], limbs)
+		if err != nil || subShare.Pieces[k] == nil {
+			ctWipe(s)
+			return nil, 0, fmt.Errorf("sub-share of custodian %d has an invalid piece %d", subShare.Custodian, k)
+		}
+		sum := ctMulAdd(piece, one, s, limbs)
+		ctWipe(s)
+		ctWipe(piece)
+		s = sum
+	}
+	return s, bits, nil
+}
+
+// checkKey checks that the sub-share belongs to the key of the key meta information and to its epoch.
+// It returns an error wrapping ErrKeyMismatch or ErrEpochMismatch if it does not.
+func (subShare SubShare) checkKey(meta *PreparedKeyMeta) error {
+	return KeyShare{Id: subShare.Id, KeyID: subShare.KeyID, Epoch: subShare.Epoch}.checkKey(meta)
+}
+
+// proofNonce returns the random value r of the part of the correctness proof of the custodian, with at most bits
+// bits, as a fixed-width number. As KeyShare.proofNonce, it is derived from the sum s of the pieces used by the
+// custodian, the custodian, the quorum and the document, and fresh randomness.
+// It returns an error if the fresh randomness cannot be read.
+func (subShare SubShare) proofNonce(s []uint64, quorum []uint16, doc []byte, bits int, meta *PreparedKeyMeta) ([]uint64, error) {
+	secret := ctLimbsToBig(s)
+	secretBytes := secret.FillBytes(make([]byte, 8*len(s)))
+	wipeInts(secret)
+	defer wipeBytes(secretBytes)
+	quorumBytes := make([]byte, 2*len(quorum))
+	for i, custodian := range quorum {
+		binary.BigEndian.PutUint16(quorumBytes[2*i:], custodian)
+	}
+	var custodian [2]byte
+	binary.BigEndian.PutUint16(custodian[:], subShare.Custodian)
+	return hedgedNonce(secretBytes, meta, subShare.Id, bits, []byte(nonceSubLabel), custodian[:], quorumBytes, doc)
+}
+
+// Commit runs the first round of the signing protocol of a sub-shared key share for the document provided, which
+// should be prepared (hashed and padded) as for KeyShare.Sign, with the custodians of the quorum, which should
+// include this one. The commitment hash should be sent to the other custodians of the quorum and to the combiner,
+// and the nonce should be kept secret until Respond is called. The commitment itself is only revealed by Reveal,
+// once the hashes of all the custodians are received.
+// It returns the commitment hash and the nonce, or an error if the quorum is invalid or the sub-share does not
+// belong to the key.
+func (subShare SubShare) Commit(doc []byte, quorum []uint16, info MetaInfo) (*SubCommitmentHash, *SubNonce, error) {
+	if doc == nil {
+		return nil, nil, fmt.Errorf("document is nil")
+	}
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := meta.checkProofVerification(); err != nil {
+		return nil, nil, err
+	}
+	if err := subShare.checkKey(meta); err != nil {
+		return nil, nil, err
+	}
+	if err := subShare.checkQuorum(quorum); err != nil {
+		return nil, nil, err
+	}
+	s, sBits, err := subShare.secretSum(quorum, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ctWipe(s)
+	exp := ctMulAdd(s, []uint64{2}, nil, len(s)+1)
+	defer ctWipe(exp)
+
+	n := meta.n
+	x, _ := meta.adjustDocument(doc)
+	// xi_j = x^(2*s) mod n
+	xi := meta.ctN.exp(x, exp)
+	// r has enough bits to hide c*s
+	rBits := sBits + meta.proof.ChallengeBits + meta.proof.HidingBits
+	r, err := subShare.proofNonce(s, quorum, doc, rBits, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	xTilde := new(big.Int).Exp(x, big.NewInt(4), n)
+	// v^r and x~^r are computed in constant time, as r would reveal s
+	commitment := &SubCommitment{
+		Id:        subShare.Id,
+		Name:      subShare.Name,
+		Custodian: subShare.Custodian,
+		Quorum:    append([]uint16{}, quorum...),
+		Xi:        xi.Bytes(),
+		V:         meta.ctN.exp(meta.v, r).Bytes(),
+		X:         meta.ctN.exp(xTilde, r).Bytes(),
+		Offset:    append([]byte{}, subShare.Offset...),
+		KeyID:     append(KeyID{}, meta.keyID...),
+		DocDigest: documentDigest(doc),
+		Epoch:     subShare.Epoch,
+	}
+	nonce := &SubNonce{
+		custodian:  subShare.Custodian,
+		quorum:     commitment.Quorum,
+		docDigest:  commitment.DocDigest,
+		commitment: commitment,
+		r:          r,
+	}
+	return &SubCommitmentHash{Custodian: subShare.Custodian, Hash: commitment.hash()}, nonce, nil
+}
+
+// Reveal runs the second round of the signing protocol of a sub-shared key share, with the nonce returned by
+// Commit and the commitment hashes of all the custodians of the quorum. The commitment should only be revealed
+// once all the hashes are received, and it should be sent to the other custodians of the quorum and to the
+// combiner.
+// It returns the commitment of the custodian, or an error if the nonce was already used or revealed, or the
+// hashes do not belong to the quorum or do not match the commitment of the custodian.
+func (subShare SubShare) Reveal(nonce *SubNonce, hashes []*SubCommitmentHash) (*SubCommitment, error) {
+	if nonce == nil || nonce.r == nil {
+		return nil, fmt.Errorf("nonce is nil or it was already used")
+	}
+	if nonce.custodian != subShare.Custodian {
+		return nil, fmt.Errorf("nonce belongs to custodian %d, but the sub-share belongs to custodian %d", nonce.custodian, subShare.Custodian)
+	}
+	if nonce.hashes != nil {
+		return nil, fmt.Errorf("commitment of custodian %d was already revealed", subShare.Custodian)
+	}
+	byCustodian, err := subHashesOf(hashes, nonce.quorum)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(byCustodian[subShare.Custodian], nonce.commitment.hash()) {
+		return nil, fmt.Errorf("commitment hash of custodian %d does not match its nonce", subShare.Custodian)
+	}
+	nonce.hashes = byCustodian
+	return nonce.commitment, nil
+}
+
+// subHashesOf returns the commitment hashes by custodian.
+// It returns an error if there is not exactly one hash for every custodian of the quorum.
+func subHashesOf(hashes []*SubCommitmentHash, quorum []uint16) (map[uint16][]byte, error) {
+	if len(hashes) != len(quorum) {
+		return nil, fmt.Errorf("there are %d commitment hashes, but the quorum has %d custodians", len(hashes), len(quorum))
+	}
+	byCustodian := make(map[uint16][]byte, len(hashes))
+	for i, hash := range hashes {
+		if hash == nil {
+			return nil, fmt.Errorf("commitment hash %d is nil", i)
+		}
+		if !containsCustodian(quorum, hash.Custodian) || byCustodian[hash.Custodian] != nil {
+			return nil, fmt.Errorf("commitment hash of custodian %d is repeated or it is not in the quorum", hash.Custodian)
+		}
+		byCustodian[hash.Custodian] = hash.Hash
+	}
+	return byCustodian, nil
+}
+
+// hash returns the SHA-256 hash of the commitment, over a domain-separated transcript of all its values.
+func (commitment *SubCommitment) hash() []byte {
+	var header [8]byte
+	binary.BigEndian.PutUint16(header[:2], commitment.Id)
+	binary.BigEndian.PutUint16(header[2:4], commitment.Custodian)
+	binary.BigEndian.PutUint32(header[4:], commitment.Epoch)
+	quorum := make([]byte, 2*len(commitment.Quorum))
+	for i, custodian := range commitment.Quorum {
+		binary.BigEndian.PutUint16(quorum[2*i:], custodian)
+	}
+	sha := sha256.New()
+	writeLengthPrefixed(sha, []byte(subCommitmentTag))
+	for _, value := range [][]byte{header[:], []byte(commitment.Name), quorum, commitment.Xi, commitment.V, commitment.X, commitment.Offset, commitment.KeyID, commitment.DocDigest} {
+		writeLengthPrefixed(sha, value)
+	}
+	return sha.Sum(nil)
+}
+
+// Respond runs the third round of the signing protocol of a sub-shared key share, with the nonce returned by
+// Commit and revealed by Reveal, and the commitments of all the custodians of the quorum, which should match their
+// hashes. It computes the challenge of the correctness proof from the commitments itself, and destroys the nonce.
+// It returns the response of the custodian, or an error if the nonce was already used or not revealed, or the
+// commitments are inconsistent with it.
+func (subShare SubShare) Respond(nonce *SubNonce, commitments []*SubCommitment, doc []byte, info MetaInfo) (*SubResponse, error) {
+	if nonce == nil || nonce.r == nil {
+		return nil, fmt.Errorf("nonce is nil or it was already used")
+	}
+	defer nonce.Destroy()
+	if nonce.custodian != subShare.Custodian {
+		return nil, fmt.Errorf("nonce belongs to custodian %d, but the sub-share belongs to custodian %d", nonce.custodian, subShare.Custodian)
+	}
+	if nonce.hashes == nil {
+		return nil, fmt.Errorf("commitment of custodian %d was not revealed", subShare.Custodian)
+	}
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(documentDigest(doc), nonce.docDigest) {
+		return nil, fmt.Errorf("custodian %d: %w", subShare.Custodian, ErrDocumentMismatch)
+	}
+	transcript, err := subTranscriptOf(nonce.hashes, commitments, doc, meta)
+	if err != nil {
+		return nil, err
+	}
+	own := transcript.commitments[subShare.Custodian]
+	if own == nil || !equalQuorums(own.Quorum, nonce.quorum) {
+		return nil, fmt.Errorf("commitment of custodian %d does not match its nonce", subShare.Custodian)
+	}
+	s, _, err := subShare.secretSum(nonce.quorum, meta)
+	if err != nil {
+		return nil, err
+	}
+	defer ctWipe(s)
+	// z_j = c*s + r
+	z := proofResponse(transcript.c, s, nonce.r)
+	return &SubResponse{Custodian: subShare.Custodian, Z: z.Bytes()}, nil
+}
+
+// subTranscript stores the values of the correctness proof of a sub-shared key share computed from the
+// commitments of the custodians.
+type subTranscript struct {
+	first       *SubCommitment
+	commitments map[uint16]*SubCommitment // Commitments by custodian.
+	xi          *big.Int                  // Signature share.
+	offset      *big.Int                  // Offset D of the sub-shares.
+	c           *big.Int                  // Challenge.
+	vPrime      *big.Int                  // Commitment v^r of the joint proof.
+	xPrime      *big.Int                  // Commitment x~^r of the joint proof.
+}
+
+// subTranscriptOf joins the commitments of the custodians of a quorum and computes the challenge of the proof.
+// It returns an error if the commitments do not match their hashes, are inconsistent, or do not belong to the
+// quorum, the key or the document.
+func subTranscriptOf(hashes map[uint16][]byte, commitments []*SubCommitment, doc []byte, meta *PreparedKeyMeta) (*subTranscript, error) {
+	if len(commitments) == 0 || commitments[0] == nil {
+		return nil, fmt.Errorf("there are no commitments")
+	}
+	first := commitments[0]
+	if len(commitments) != len(first.Quorum) {
+		return nil, fmt.Errorf("there are %d commitments, but the quorum has %d custodians", len(commitments), len(first.Quorum))
+	}
+	n := meta.n
+	docDigest := documentDigest(doc)
+	t := &subTranscript{
+		first:       first,
+		commitments: make(map[uint16]*SubCommitment, len(commitments)),
+		offset:      new(big.Int).SetBytes(first.Offset),
+	}
+	xi := big.NewInt(1)
+	vPrime := big.NewInt(1)
+	xPrime := big.NewInt(1)
+	for i, commitment := range commitments {
+		if commitment == nil {
+			return nil, fmt.Errorf("commitment %d is nil", i)
+		}
+		if commitment.Id != first.Id || commitment.Name != first.Name || !equalQuorums(commitment.Quorum, first.Quorum) || !bytes.Equal(commitment.Offset, first.Offset) {
+			return nil, fmt.Errorf("commitment of custodian %d is inconsistent with the others", commitment.Custodian)
+		}
+		if !containsCustodian(first.Quorum, commitment.Custodian) || t.commitments[commitment.Custodian] != nil {
+			return nil, fmt.Errorf("commitment of custodian %d is repeated or it is not in the quorum", commitment.Custodian)
+		}
+		if len(commitment.KeyID) != 0 && !commitment.KeyID.Equal(meta.keyID) {
+			return nil, fmt.Errorf("commitment of custodian %d: %w", commitment.Custodian, ErrKeyMismatch)
+		}
+		if !bytes.Equal(commitment.DocDigest, docDigest) {
+			return nil, fmt.Errorf("commitment of custodian %d: %w", commitment.Custodian, ErrDocumentMismatch)
+		}
+		if commitment.Epoch != meta.Epoch {
+			return nil, fmt.Errorf("commitment of custodian %d has epoch %d, but the key has epoch %d: %w", commitment.Custodian, commitment.Epoch, meta.Epoch, ErrEpochMismatch)
+		}
+		if !bytes.Equal(commitment.hash(), hashes[commitment.Custodian]) {
+			return nil, fmt.Errorf("commitment of custodian %d does not match its hash", commitment.Custodian)
+		}
+		t.commitments[commitment.Custodian] = commitment
+		for _, value := range []struct {
+			product *big.Int
+			factor  []byte
+		}{{xi, commitment.Xi}, {vPrime, commitment.V}, {xPrime, commitment.X}} {
+			factor := new(big.Int).SetBytes(value.factor)
+			if factor.Sign() == 0 || factor.Cmp(n) >= 0 {
+				return nil, fmt.Errorf("commitment of custodian %d has an invalid value", commitment.Custodian)
+			}
+			value.product.Mul(value.product, factor).Mod(value.product, n)
+		}
+	}
+	id, err := meta.participantId(first.Name, first.Id)
+	if err != nil {
+		return nil, err
+	}
+	vki, err := meta.verificationKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// xi = prod(xi_j) * x^(-2*D)
+	x, _ := meta.adjustDocument(doc)
+	xOffset := new(big.Int).Exp(x, new(big.Int).Lsh(t.offset, 1), n)
+	if xOffset.ModInverse(xOffset, n) == nil {
+		return nil, fmt.Errorf("document is not invertible modulo n")
+	}
+	t.xi = xi.Mul(xi, xOffset).Mod(xi, n)
+	t.vPrime, t.xPrime = vPrime, xPrime
+	xTilde := x.Exp(x, big.NewInt(4), n)
+	t.c, err = meta.shareChallenge(ProofVersion1, id, nil, &proofValues{
+		xTilde: xTilde,
+		vki:    vki,
+		xi2:    new(big.Int).Exp(t.xi, big.NewInt(2), n),
+		vPrime: vPrime,
+		xPrime: xPrime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// equalQuorums returns true if both quorums have the same custodians in the same order.
+func equalQuorums(q1, q2 []uint16) bool {
+	if len(q1) != len(q2) {
+		return false
+	}
+	for i := range q1 {
+		if q1[i] != q2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// JoinSubShares combines the commitment hashes, the commitments and the responses of the custodians of a quorum of
+// a sub-shared key share into the signature share of the key share for the document provided, with a correctness
+// proof in the ProofVersion1 format, and verifies it.
+// It returns the signature share, or an error if the messages are inconsistent, the commitments do not match their
+// hashes or the signature share is invalid.
+func JoinSubShares(hashes []*SubCommitmentHash, commitments []*SubCommitment, responses []*SubResponse, doc []byte, info MetaInfo) (*SigShare, error) {
+	if doc == nil {
+		return nil, fmt.Errorf("document is nil")
+	}
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	if len(commitments) == 0 || commitments[0] == nil {
+		return nil, fmt.Errorf("there are no commitments")
+	}
+	byCustodian, err := subHashesOf(hashes, commitments[0].Quorum)
+	if err != nil {
+		return nil, err
+	}
+	transcript, err := subTranscriptOf(byCustodian, commitments, doc, meta)
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) != len(commitments) {
+		return nil, fmt.Errorf("there are %d responses, but there are %d commitments", len(responses), len(commitments))
+	}
+	// z = sum(z_j) - c*D = c*si + sum(r_j)
+	z := new(big.Int).Mul(transcript.c, transcript.offset)
+	z.Neg(z)
+	responded := make(map[uint16]bool, len(responses))
+	for i, response := range responses {
+		if response == nil {
+			return nil, fmt.Errorf("response %d is nil", i)
+		}
+		if transcript.commitments[response.Custodian] == nil || responded[response.Custodian] {
+			return nil, fmt.Errorf("response of custodian %d is repeated or it has no commitment", response.Custodian)
+		}
+		responded[response.Custodian] = true
+		z.Add(z, new(big.Int).SetBytes(response.Z))
+	}
+	if z.Sign() < 0 {
+		return nil, fmt.Errorf("invalid responses of the custodians")
+	}
+	first := transcript.first
+	sigShare := &SigShare{
+		Id:        first.Id,
+		Name:      first.Name,
+		Version:   ProofVersion1,
+		Xi:        transcript.xi.Bytes(),
+		C:         transcript.c.Bytes(),
+		Z:         z.Bytes(),
+		KeyID:     append(KeyID{}, meta.keyID...),
+		DocDigest: documentDigest(doc),
+		Epoch:     first.Epoch,
+		V:         transcript.vPrime.Bytes(),
+		X:         transcript.xPrime.Bytes(),
+	}
+	if err := sigShare.Verify(doc, meta); err != nil {
+		return nil, err
+	}
+	return sigShare, nil
+}
@@ -0,0 +1,178 @@
+package tcrsa_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"github.com/niclabs/tcrsa"
+	"math/big"
+	"testing"
+)
+
+// subSign runs the signing protocol of a sub-shared key share with the custodians of the quorum.
+func subSign(t *testing.T, subShares []*tcrsa.SubShare, quorum []uint16, doc []byte, info tcrsa.MetaInfo) ([]*tcrsa.SubCommitmentHash, []*tcrsa.SubCommitment, []*tcrsa.SubResponse) {
+	hashes := make([]*tcrsa.SubCommitmentHash, len(quorum))
+	nonces := make([]*tcrsa.SubNonce, len(quorum))
+	for i, custodian := range quorum {
+		var err error
+		if hashes[i], nonces[i], err = subShares[custodian-1].Commit(doc, quorum, info); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	commitments := make([]*tcrsa.SubCommitment, len(quorum))
+	for i, custodian := range quorum {
+		var err error
+		if commitments[i], err = subShares[custodian-1].Reveal(nonces[i], hashes); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	responses := make([]*tcrsa.SubResponse, len(quorum))
+	for i, custodian := range quorum {
+		var err error
+		if responses[i], err = subShares[custodian-1].Respond(nonces[i], commitments, doc, info); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	return hashes, commitments, responses
+}
+
+func TestKeyShare_SubShare(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	docs, hashes := batchDocs(t, 1, keyMeta)
+	for _, c := range []struct{ threshold, custodians uint16 }{{2, 3}, {1, 2}, {3, 3}, {3, 5}} {
+		subShares, err := keyShares[1].SubShare(c.threshold, c.custodians, keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		quorums := [][]uint16{{}, {}}
+		for custodian := uint16(1); custodian <= c.custodians; custodian++ {
+			if custodian <= c.threshold {
+				quorums[0] = append(quorums[0], custodian)
+			}
+			if custodian > c.custodians-c.threshold {
+				quorums[1] = append(quorums[1], custodian)
+			}
+		}
+		for _, quorum := range quorums {
+			commitHashes, commitments, responses := subSign(t, subShares, quorum, docs[0], keyMeta)
+			sigShare, err := tcrsa.JoinSubShares(commitHashes, commitments, responses, docs[0], keyMeta)
+			if err != nil {
+				t.Fatalf("%d-of-%d custodians %v: %v", c.threshold, c.custodians, quorum, err)
+			}
+			if sigShare.Id != keyShares[1].Id {
+				t.Errorf("signature share should have id %d, but it has id %d", keyShares[1].Id, sigShare.Id)
+			}
+
+			// The outer key joins the signature share as any other.
+			sigShares := tcrsa.SigShareList{sigShare}
+			for _, keyShare := range []*tcrsa.KeyShare{keyShares[0], keyShares[3]} {
+				other, err := keyShare.Sign(docs[0], keyTestHashType, keyMeta)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				sigShares = append(sigShares, other)
+			}
+			signature, err := sigShares.Join(docs[0], keyMeta)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, hashes[0], signature); err != nil {
+				t.Errorf("%v", err)
+			}
+		}
+	}
+}
+
+func TestKeyShare_SubShareInvalid(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	docs, _ := batchDocs(t, 2, keyMeta)
+	if _, err := keyShares[0].SubShare(4, 3, keyMeta); err == nil {
+		t.Errorf("threshold larger than the number of custodians should be invalid")
+	}
+	subShares, err := keyShares[0].SubShare(2, 3, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, _, err := subShares[0].Commit(docs[0], []uint16{1}, keyMeta); err == nil {
+		t.Errorf("quorum smaller than the threshold should be invalid")
+	}
+	if _, _, err := subShares[0].Commit(docs[0], []uint16{2, 3}, keyMeta); err == nil {
+		t.Errorf("custodians outside the quorum should not commit")
+	}
+
+	quorum := []uint16{1, 3}
+	hash1, nonce1, err := subShares[0].Commit(docs[0], quorum, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hash3, nonce3, err := subShares[2].Commit(docs[0], quorum, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hashes := []*tcrsa.SubCommitmentHash{hash1, hash3}
+	if _, unrevealed, err := subShares[0].Commit(docs[0], quorum, keyMeta); err != nil {
+		t.Fatalf("%v", err)
+	} else if _, err := subShares[0].Respond(unrevealed, nil, docs[0], keyMeta); err == nil {
+		t.Errorf("response should need the commitment to be revealed")
+	}
+	if _, err := subShares[0].Reveal(nonce1, hashes[:1]); err == nil {
+		t.Errorf("commitment should only be revealed with the hashes of the whole quorum")
+	}
+	if _, err := subShares[0].Reveal(nonce1, []*tcrsa.SubCommitmentHash{hash3, hash3}); err == nil {
+		t.Errorf("commitment should not be revealed with repeated hashes")
+	}
+	if _, err := subShares[0].Reveal(nonce1, []*tcrsa.SubCommitmentHash{{Custodian: 1, Hash: hash3.Hash}, hash3}); err == nil {
+		t.Errorf("commitment should not be revealed with a hash that does not match it")
+	}
+	commitment1, err := subShares[0].Reveal(nonce1, hashes)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := subShares[0].Reveal(nonce1, hashes); err == nil {
+		t.Errorf("commitment should not be revealed twice")
+	}
+	commitment3, err := subShares[2].Reveal(nonce3, hashes)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	commitments := []*tcrsa.SubCommitment{commitment1, commitment3}
+	if _, err := subShares[0].Respond(nonce1, commitments[:1], docs[0], keyMeta); err == nil {
+		t.Errorf("response should need the commitments of the whole quorum")
+	}
+	if _, err := subShares[0].Respond(nonce1, commitments, docs[0], keyMeta); err == nil {
+		t.Errorf("nonce should not be used twice")
+	}
+	if _, err := subShares[2].Respond(nonce3, commitments, docs[1], keyMeta); err == nil {
+		t.Errorf("response should be for the committed document")
+	}
+
+	// A commitment changed after its hash was published is rejected, by the custodians and by the combiner.
+	hash1, nonce1, err = subShares[0].Commit(docs[0], quorum, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hashes = []*tcrsa.SubCommitmentHash{hash1, hash3}
+	if commitment1, err = subShares[0].Reveal(nonce1, hashes); err != nil {
+		t.Fatalf("%v", err)
+	}
+	changed := *commitment3
+	changed.V = commitment1.V
+	if _, err := subShares[0].Respond(nonce1, []*tcrsa.SubCommitment{commitment1, &changed}, docs[0], keyMeta); err == nil {
+		t.Errorf("commitment that does not match its hash should be rejected")
+	}
+	hashes, commitments, responses := subSign(t, subShares, quorum, docs[0], keyMeta)
+	if _, err := tcrsa.JoinSubShares(hashes[:1], commitments, responses, docs[0], keyMeta); err == nil {
+		t.Errorf("joining should need the hashes of the whole quorum")
+	}
+	changed = *commitments[1]
+	changed.X = commitments[0].X
+	if _, err := tcrsa.JoinSubShares(hashes, []*tcrsa.SubCommitment{commitments[0], &changed}, responses, docs[0], keyMeta); err == nil {
+		t.Errorf("commitment that does not match its hash should not be joined")
+	}
+
+	// A modified response produces an invalid signature share.
+	z := new(big.Int).SetBytes(responses[0].Z)
+	responses[0].Z = z.Add(z, big.NewInt(1)).Bytes()
+	if _, err := tcrsa.JoinSubShares(hashes, commitments, responses, docs[0], keyMeta); err == nil {
+		t.Errorf("modified response should produce an invalid signature share")
+	}
+}
@@ -0,0 +1,87 @@
+package tcrsa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+)
+
+// Domain separation tag of the derivation of the proof nonces.
+const nonceTag = "tcrsa/proof-nonce/v1"
+
+// Labels of the statements whose proof nonces are derived.
+const (
+	nonceShareLabel = "share"
+	nonceBatchLabel = "batch"
+	nonceSubLabel   = "sub-share"
+)
+
+// Size in bytes of the fresh randomness mixed in the proof nonces.
+const nonceFreshSize = 32
+
+// proofNonce returns the random value r of a correctness proof, with at most bits bits. As the hedged nonces
+// of RFC 6979, it is derived from the S_i value of the key share, the statement being proved and fresh
+// randomness, so it remains secret and distinct for different statements even if the random source of the
+// node is faulty or repeats its output. It is returned as a fixed-width number of ctLimbsLen(bits) limbs, so
+// it can only be used in the constant-time operations.
+// It returns an error if the fresh randomness cannot be read.
+func (keyShare KeyShare) proofNonce(meta *PreparedKeyMeta, bits int, statement ...[]byte) ([]uint64, error) {
+	return hedgedNonce(keyShare.Si, meta, keyShare.Id, bits, statement...)
+}
+
+// hedgedNonce returns a nonce of at most bits bits as a fixed-width number of ctLimbsLen(bits) limbs, derived
+// from a secret of the key share with the id provided, the modulus of the key, the statement and fresh
+// randomness.
+// It returns an error if the fresh randomness cannot be read.
+func hedgedNonce(secret []byte, meta *PreparedKeyMeta, id uint16, bits int, statement ...[]byte) ([]uint64, error) {
+	fresh := make([]byte, nonceFreshSize)
+	if _, err := rand.Read(fresh); err != nil {
+		return nil, err
+	}
+	var idBytes [2]byte
+	binary.BigEndian.PutUint16(idBytes[:], id)
+	r := deriveNonce(secret, fresh, bits, append([][]byte{meta.n.Bytes(), idBytes[:]}, statement...)...)
+	defer wipeInts(r)
+	limbs := ctLimbsLen(bits)
+	b := r.FillBytes(make([]byte, 8*limbs))
+	defer wipeBytes(b)
+	return ctLimbsFromBytes(b, limbs)
+}
+
+// deriveNonce derives a nonce of at most bits bits from a secret, fresh randomness and the values of a
+// statement. A pseudorandom key is extracted with HMAC-SHA256 keyed by the secret over the tag, the
+// length-prefixed statement values and the fresh randomness, and it is expanded with HMAC-SHA256 in
+// counter mode as HKDF-Expand.
+func deriveNonce(secret, fresh []byte, bits int, statement ...[]byte) *big.Int {
+	mac := hmac.New(sha256.New, secret)
+	writeLengthPrefixed(mac, []byte(nonceTag))
+	for _, value := range statement {
+		writeLengthPrefixed(mac, value)
+	}
+	writeLengthPrefixed(mac, fresh)
+	prk := mac.Sum(nil)
+	defer wipeBytes(prk)
+
+	size := (bits + 7) / 8
+	out := make([]byte, 0, size+sha256.Size)
+	defer wipeBytes(out[:cap(out)])
+	expand := hmac.New(sha256.New, prk)
+	var block []byte
+	for counter := uint32(1); len(out) < size; counter++ {
+		// T(i) = HMAC(prk, T(i-1) || tag || i)
+		var counterBytes [4]byte
+		binary.BigEndian.PutUint32(counterBytes[:], counter)
+		expand.Reset()
+		expand.Write(block)
+		expand.Write([]byte(nonceTag))
+		expand.Write(counterBytes[:])
+		out = expand.Sum(out)
+		block = out[len(out)-sha256.Size:]
+	}
+	out = out[:size]
+	// Clear the bits over the bit length.
+	out[0] &= byte(0xff >> uint(8*size-bits))
+	return new(big.Int).SetBytes(out)
+}
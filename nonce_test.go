@@ -0,0 +1,89 @@
+package tcrsa
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors of the nonce derivation. They were checked with an independent implementation.
+var nonceTestVectors = []struct {
+	secret, fresh string
+	bits          int
+	statement     []string
+	nonce         string
+}{
+	{"secret", "fresh", 256, []string{"a", "b"}, "57c7253c94377639fc7982e71b92fb8acee14c4c1c936a70565fdbd1348c1a6b"},
+	{"secret", "fresh", 300, []string{"ab"}, "0a69f1371572eb2024e00a6821d97dd969b1eb0982af89ce5f250bca65bd38660c5f35f7d9cb"},
+	{"secret", string(make([]byte, 32)), 12, []string{""}, "025a"},
+}
+
+func TestDeriveNonce_vectors(t *testing.T) {
+	for i, v := range nonceTestVectors {
+		statement := make([][]byte, len(v.statement))
+		for j, value := range v.statement {
+			statement[j] = []byte(value)
+		}
+		nonce := deriveNonce([]byte(v.secret), []byte(v.fresh), v.bits, statement...)
+		if got := hex.EncodeToString(nonce.FillBytes(make([]byte, (v.bits+7)/8))); got != v.nonce {
+			t.Errorf("vector %d: nonce should be %s, but it is %s", i, v.nonce, got)
+		}
+		if nonce.BitLen() > v.bits {
+			t.Errorf("vector %d: nonce has %d bits, but it should have at most %d", i, nonce.BitLen(), v.bits)
+		}
+	}
+}
+
+func TestDeriveNonce_inputs(t *testing.T) {
+	base := deriveNonce([]byte("secret"), []byte("fresh"), 1024, []byte("a"), []byte("b"))
+	others := map[string][]byte{
+		"secret":    deriveNonce([]byte("secret2"), []byte("fresh"), 1024, []byte("a"), []byte("b")).Bytes(),
+		"fresh":     deriveNonce([]byte("secret"), []byte("fresh2"), 1024, []byte("a"), []byte("b")).Bytes(),
+		"statement": deriveNonce([]byte("secret"), []byte("fresh"), 1024, []byte("a"), []byte("c")).Bytes(),
+		"framing":   deriveNonce([]byte("secret"), []byte("fresh"), 1024, []byte("ab")).Bytes(),
+	}
+	for name, other := range others {
+		if string(other) == string(base.Bytes()) {
+			t.Errorf("nonce should change with the %s", name)
+		}
+	}
+	if deriveNonce([]byte("secret"), []byte("fresh"), 1024, []byte("a"), []byte("b")).Cmp(base) != 0 {
+		t.Errorf("nonce should be deterministic")
+	}
+}
+
+// TestKeyShare_proofNonce checks that the nonces of a share are bound to the statement being proved.
+func TestKeyShare_proofNonce(t *testing.T) {
+	keyShares, keyMeta, err := NewKey(512, 2, 3, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	meta, err := keyMeta.prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	docHash := sha256.Sum256([]byte("proof nonce"))
+	doc, err := PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, docHash[:])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	bits := meta.proof.randomBits(meta.n.BitLen())
+	r1, err := keyShares[0].proofNonce(meta, bits, []byte(nonceShareLabel), doc)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	r2, err := keyShares[0].proofNonce(meta, bits, []byte(nonceShareLabel), doc)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(r1) != ctLimbsLen(bits) || len(r2) != ctLimbsLen(bits) {
+		t.Fatalf("nonces should have %d limbs", ctLimbsLen(bits))
+	}
+	if ctLimbsToBig(r1).Cmp(ctLimbsToBig(r2)) == 0 {
+		t.Errorf("nonces of the same statement should differ with fresh randomness")
+	}
+	if ctLimbsToBig(r1).BitLen() > bits || ctLimbsToBig(r2).BitLen() > bits {
+		t.Errorf("nonces should have at most %d bits", bits)
+	}
+}
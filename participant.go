@@ -0,0 +1,254 @@
+package tcrsa
+
+import "fmt"
+
+// Participant maps a name chosen by the caller, such as a hostname or a UUID, to the ids of its key shares, which
+// are their evaluation points in the polynomial of the key and the positions of their verification values.
+// A participant with weight w holds w key shares with consecutive ids, and counts as w signers for the threshold.
+type Participant struct {
+	Name   string // Name of the participant.
+	Id     uint16 // ID of the first key share of the participant, between 1 and L.
+	Weight uint16 // Number of key shares of the participant. Zero is equivalent to one.
+}
+
+// weight returns the number of key shares of the participant.
+func (participant Participant) weight() uint16 {
+	if participant.Weight == 0 {
+		return 1
+	}
+	return participant.Weight
+}
+
+// newParticipants assigns consecutive ids to the names provided, as many as their weights. The participants with
+// an id in ids keep it, so a key dealt again keeps the ids of its previous participants, and the others are
+// assigned the lowest free ids, in the same order. Participants without a weight have weight one.
+// It returns an error if the weights do not add up to l, if any weight is zero, if any weight or id does not belong
+// to a participant, if the ids are out of range or overlap, or if any name is empty or repeated.
+func newParticipants(names []string, weights, ids map[string]uint16, l uint16) ([]Participant, error) {
+	participants := make([]Participant, len(names))
+	known := make(map[string]bool, len(names))
+	total := 0
+	for i, name := range names {
+		weight, ok := weights[name]
+		if !ok {
+			weight = 1
+		}
+		if weight == 0 {
+			return nil, fmt.Errorf("participant %q has weight 0", name)
+		}
+		participants[i] = Participant{Name: name}
+		if weight != 1 {
+			participants[i].Weight = weight
+		}
+		total += int(weight)
+		known[name] = true
+	}
+	if total != int(l) {
+		return nil, fmt.Errorf("participants have %d shares, but there should be %d", total, l)
+	}
+	for name := range weights {
+		if !known[name] {
+			return nil, fmt.Errorf("weight of %q does not belong to any participant", name)
+		}
+	}
+	for name := range ids {
+		if !known[name] {
+			return nil, fmt.Errorf("id of %q does not belong to any participant", name)
+		}
+	}
+
+	used := make([]bool, int(l)+1)
+	assign := func(participant *Participant, id int) error {
+		last := id + int(participant.weight()) - 1
+		if id < 1 || last > int(l) {
+			return fmt.Errorf("participant %q has ids from %d to %d, but they should be between 1 and %d", participant.Name, id, last, l)
+		}
+		for j := id; j <= last; j++ {
+			if used[j] {
+				return fmt.Errorf("there is more than one participant with id %d", j)
+			}
+			used[j] = true
+		}
+		participant.Id = uint16(id)
+		return nil
+	}
+	for i := range participants {
+		if id, ok := ids[participants[i].Name]; ok {
+			if err := assign(&participants[i], int(id)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := range participants {
+		if _, ok := ids[participants[i].Name]; ok {
+			continue
+		}
+		// Lowest run of free ids as long as the weight of the participant.
+		id, free := 0, 0
+		for j := 1; j <= int(l) && free < int(participants[i].weight()); j++ {
+			if used[j] {
+				free = 0
+				continue
+			}
+			if free == 0 {
+				id = j
+			}
+			free++
+		}
+		if free < int(participants[i].weight()) {
+			return nil, fmt.Errorf("there are not %d consecutive free ids for participant %q", participants[i].weight(), participants[i].Name)
+		}
+		if err := assign(&participants[i], id); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := participantsByName(participants, l); err != nil {
+		return nil, err
+	}
+	return participants, nil
+}
+
+// participantsByName returns the participants by name.
+// It returns an error if any name is empty or repeated, or if any id is out of range or belongs to more
+// than one participant.
+func participantsByName(participants []Participant, l uint16) (map[string]Participant, error) {
+	byName := make(map[string]Participant, len(participants))
+	used := make(map[uint16]bool, len(participants))
+	for _, participant := range participants {
+		if participant.Name == "" {
+			return nil, fmt.Errorf("participant with id %d has an empty name", participant.Id)
+		}
+		if _, ok := byName[participant.Name]; ok {
+			return nil, fmt.Errorf("there is more than one participant named %q", participant.Name)
+		}
+		last := int(participant.Id) + int(participant.weight()) - 1
+		if participant.Id < 1 || last > int(l) {
+			return nil, fmt.Errorf("participant %q has ids from %d to %d, but they should be between 1 and %d", participant.Name, participant.Id, last, l)
+		}
+		for id := int(participant.Id); id <= last; id++ {
+			if used[uint16(id)] {
+				return nil, fmt.Errorf("there is more than one participant with id %d", id)
+			}
+			used[uint16(id)] = true
+		}
+		byName[participant.Name] = participant
+	}
+	return byName, nil
+}
+
+// Weights returns the weights of the participants of the key by name, or nil if the key has no
+// participant names.
+func (keyMeta *KeyMeta) Weights() map[string]uint16 {
+	if len(keyMeta.Participants) == 0 {
+		return nil
+	}
+	weights := make(map[string]uint16, len(keyMeta.Participants))
+	for _, participant := range keyMeta.Participants {
+		weights[participant.Name] = participant.weight()
+	}
+	return weights
+}
+
+// Ids returns the id of the first key share of the participants of the key by name, or nil if the key has no
+// participant names. They can be given to KeyMetaArgs.Ids to deal the key again keeping the ids of the
+// participants.
+func (keyMeta *KeyMeta) Ids() map[string]uint16 {
+	if len(keyMeta.Participants) == 0 {
+		return nil
+	}
+	ids := make(map[string]uint16, len(keyMeta.Participants))
+	for _, participant := range keyMeta.Participants {
+		ids[participant.Name] = participant.Id
+	}
+	return ids
+}
+
+// RemoveParticipants returns a copy of the key meta information without the participants with the names provided.
+// The other participants keep their ids, and the signature shares of the removed participants are rejected,
+// whether they are addressed by name or by id. The key shares of the removed participants are still shares of the
+// private key, so the key should be dealt again, with a new epoch, to revoke them.
+// It returns an error if the key has no participant names or it has an access structure policy, if any name is
+// not a participant of the key, or if the remaining participants have less than K key shares.
+func (keyMeta *KeyMeta) RemoveParticipants(names ...string) (*KeyMeta, error) {
+	if len(keyMeta.Participants) == 0 {
+		return nil, fmt.Errorf("key has no participant names")
+	}
+	if keyMeta.Policy != "" {
+		return nil, fmt.Errorf("participants of a policy key are defined by the policy")
+	}
+	removed := make(map[string]bool, len(names))
+	for _, name := range names {
+		removed[name] = true
+	}
+	participants := make([]Participant, 0, len(keyMeta.Participants))
+	shares := 0
+	for _, participant := range keyMeta.Participants {
+		if removed[participant.Name] {
+			delete(removed, participant.Name)
+			continue
+		}
+		participants = append(participants, participant)
+		shares += int(participant.weight())
+	}
+	for name := range removed {
+		return nil, fmt.Errorf("participant %q is not a participant of the key", name)
+	}
+	if shares < int(keyMeta.K) {
+		return nil, fmt.Errorf("remaining participants have %d shares, but there should be at least %d", shares, keyMeta.K)
+	}
+	copied := *keyMeta
+	copied.Participants = participants
+	return &copied, nil
+}
+
+// participantId returns the id of a share of a participant. If the name is empty, the share is addressed
+// by its id, which is returned unchanged if it belongs to a participant or the key has no participant names. The id can be omitted for participants with only one share.
+// It returns an error if the participant is unknown, if the id is omitted for a participant with several
+// shares, or if the id does not belong to the participant.
+func (prepared *PreparedKeyMeta) participantId(name string, id uint16) (uint16, error) {
+	if name == "" {
+		// The ids without a participant belong to removed participants.
+		if len(prepared.Participants) != 0 && prepared.owners[id] == "" {
+			return 0, fmt.Errorf("share with id %d does not belong to any participant of the key", id)
+		}
+		return id, nil
+	}
+	participant, ok := prepared.participants[name]
+	if !ok {
+		return 0, fmt.Errorf("participant %q is not a participant of the key", name)
+	}
+	weight := participant.weight()
+	if id == 0 {
+		if weight > 1 {
+			return 0, fmt.Errorf("participant %q has %d shares, so the share id is needed", name, weight)
+		}
+		return participant.Id, nil
+	}
+	if id < participant.Id || int(id) >= int(participant.Id)+int(weight) {
+		return 0, fmt.Errorf("share with id %d does not belong to participant %q", id, name)
+	}
+	return id, nil
+}
+
+// resolve returns the list with the ids of the signature shares addressed by name resolved. The shares are
+// copied when their id changes, so the list provided is not modified.
+// It returns an error if any share is nil or its participant cannot be resolved.
+func (sigShareList SigShareList) resolve(meta *PreparedKeyMeta) (SigShareList, error) {
+	resolved := make(SigShareList, len(sigShareList))
+	for i, sigShare := range sigShareList {
+		if sigShare == nil {
+			return nil, fmt.Errorf("signature share %d is nil", i)
+		}
+		id, err := meta.participantId(sigShare.Name, sigShare.Id)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = sigShare
+		if id != sigShare.Id {
+			copied := *sigShare
+			copied.Id = id
+			resolved[i] = &copied
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,218 @@
+package tcrsa_test
+
+import (
+	"crypto/rsa"
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+var participantTestNames = []string{
+	"node-a.example.com",
+	"node-b.example.com",
+	"node-c.example.com",
+	"2b9f1c3e-0d4a-4f8e-9a61-7c5d2e8b3f10",
+	"e0c7a5d2-41b8-4c3f-8f7e-16a9d0b24c58",
+}
+
+func TestParticipants(t *testing.T) {
+	args := fixedKeyArgs(t)
+	args.Participants = participantTestNames
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i, keyShare := range keyShares {
+		if keyShare.Name != participantTestNames[i] || keyMeta.Participants[i].Name != keyShare.Name || keyMeta.Participants[i].Id != keyShare.Id {
+			t.Errorf("key share %d should belong to participant %s", keyShare.Id, participantTestNames[i])
+		}
+	}
+
+	docs, hashes := batchDocs(t, 1, keyMeta)
+	sigShares := make(tcrsa.SigShareList, len(keyShares))
+	for i, keyShare := range keyShares {
+		// The shares can be addressed by name only.
+		named := *keyShare
+		named.Id = 0
+		if sigShares[i], err = named.Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if sigShares[i].Name != keyShare.Name || sigShares[i].Id != keyShare.Id {
+			t.Errorf("signature share should belong to participant %s with id %d", keyShare.Name, keyShare.Id)
+		}
+		sigShares[i].Id = 0
+		if err := sigShares[i].Verify(docs[0], keyMeta); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+	if _, err := sigShares.VerifyParallel(docs[0], keyMeta, 0); err != nil {
+		t.Errorf("%v", err)
+	}
+	if _, err := sigShares.BatchVerify(docs[0], keyMeta); err != nil {
+		t.Errorf("%v", err)
+	}
+	signature, err := sigShares[1:].Join(docs[0], keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, keyTestHashType, hashes[0], signature); err != nil {
+		t.Errorf("%v", err)
+	}
+	for _, sigShare := range sigShares {
+		if sigShare.Id != 0 {
+			t.Errorf("join should not modify the signature shares")
+		}
+	}
+
+	// Removing a participant does not change the ids of the others.
+	removed := *keyMeta
+	removed.Participants = keyMeta.Participants[1:]
+	if _, err := sigShares[1:].Join(docs[0], &removed); err != nil {
+		t.Errorf("%v", err)
+	}
+	if err := sigShares[0].Verify(docs[0], &removed); err == nil {
+		t.Errorf("signature share of a removed participant should not be valid")
+	}
+
+	unknown := *sigShares[0]
+	unknown.Name = "node-z.example.com"
+	if err := unknown.Verify(docs[0], keyMeta); err == nil {
+		t.Errorf("signature share of an unknown participant should not be valid")
+	}
+	wrongId := *sigShares[0]
+	wrongId.Id = 2
+	if err := wrongId.Verify(docs[0], keyMeta); err == nil {
+		t.Errorf("signature share with an id different from the one of its participant should not be valid")
+	}
+}
+
+func TestParticipants_invalid(t *testing.T) {
+	for _, names := range [][]string{
+		{"a", "b", "c", "d"},
+		{"a", "b", "c", "d", "e", "f"},
+		{"a", "b", "c", "d", "a"},
+		{"a", "b", "", "d", "e"},
+	} {
+		args := fixedKeyArgs(t)
+		args.Participants = names
+		if _, _, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args); err == nil {
+			t.Errorf("participants %q should not be accepted", names)
+		}
+	}
+}
+
+func TestParticipants_removeAndAdd(t *testing.T) {
+	args := fixedKeyArgs(t)
+	args.Participants = participantTestNames
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	docs, hashes := batchDocs(t, 1, keyMeta)
+	sigShares, err := keyShares.Sign(docs[0], keyTestHashType, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The other participants keep their ids, and the removed one cannot sign by name or by id.
+	removed, err := keyMeta.RemoveParticipants(participantTestNames[1])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for name, id := range removed.Ids() {
+		if keyMeta.Ids()[name] != id {
+			t.Errorf("participant %s should keep id %d, but it has id %d", name, keyMeta.Ids()[name], id)
+		}
+	}
+	if len(removed.Ids()) != len(participantTestNames)-1 {
+		t.Errorf("removed participant should not have an id")
+	}
+	if _, err := keyShares[1].Sign(docs[0], keyTestHashType, removed); err == nil {
+		t.Errorf("removed participant should not sign")
+	}
+	byId := *sigShares[1]
+	byId.Name = ""
+	if err := byId.Verify(docs[0], removed); err == nil {
+		t.Errorf("signature share of a removed participant should not be valid by id")
+	}
+	if _, err := append(tcrsa.SigShareList{&byId}, sigShares[2:4]...).Join(docs[0], removed); err == nil {
+		t.Errorf("signature share of a removed participant should not be joined by id")
+	}
+	kept := tcrsa.SigShareList{sigShares[0], sigShares[2], sigShares[4]}
+	signature, err := kept.Join(docs[0], removed)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(removed.PublicKey, keyTestHashType, hashes[0], signature); err != nil {
+		t.Errorf("%v", err)
+	}
+	if _, err := removed.RemoveParticipants("node-z.example.com"); err == nil {
+		t.Errorf("unknown participant should not be removed")
+	}
+	if _, err := removed.RemoveParticipants(participantTestNames[0], participantTestNames[2]); err == nil {
+		t.Errorf("participants should not be removed below the threshold")
+	}
+
+	// A new participant is added by dealing the key again, and it takes the free id.
+	args = fixedKeyArgs(t)
+	args.Epoch = keyMeta.Epoch + 1
+	args.Participants = []string{participantTestNames[0], participantTestNames[2], participantTestNames[3], participantTestNames[4], "node-f.example.com"}
+	args.Ids = removed.Ids()
+	newShares, newMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for name, id := range removed.Ids() {
+		if newMeta.Ids()[name] != id {
+			t.Errorf("participant %s should keep id %d, but it has id %d", name, id, newMeta.Ids()[name])
+		}
+	}
+	if added := newShares.Participant("node-f.example.com"); len(added) != 1 || added[0].Id != 2 {
+		t.Errorf("new participant should have the free id 2")
+	}
+	newSigShares, err := newShares.Sign(docs[0], keyTestHashType, newMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	signature, err = newSigShares[1:4].Join(docs[0], newMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(newMeta.PublicKey, keyTestHashType, hashes[0], signature); err != nil {
+		t.Errorf("%v", err)
+	}
+	// The key shares of the removed participant do not belong to the new dealing.
+	if _, err := keyShares[1].Sign(docs[0], keyTestHashType, newMeta); err == nil {
+		t.Errorf("key share of the previous dealing should not sign")
+	}
+}
+
+func TestParticipants_invalidIds(t *testing.T) {
+	for _, ids := range []map[string]uint16{
+		{"a": 1, "b": 1},
+		{"a": 0},
+		{"a": 6},
+		{"z": 1},
+	} {
+		args := fixedKeyArgs(t)
+		args.Participants = []string{"a", "b", "c", "d", "e"}
+		args.Ids = ids
+		if _, _, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args); err == nil {
+			t.Errorf("ids %v should not be accepted", ids)
+		}
+	}
+	args := fixedKeyArgs(t)
+	args.Participants = []string{"a", "b", "c"}
+	args.Weights = map[string]uint16{"a": 2, "b": 2}
+	args.Ids = map[string]uint16{"a": 2}
+	// The free ids are 1 and 4 and 5, so b with weight 2 takes 4 and 5, and c takes 1.
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ids := keyMeta.Ids(); ids["a"] != 2 || ids["b"] != 4 || ids["c"] != 1 {
+		t.Errorf("ids should be a: 2, b: 4 and c: 1, but they are %v", ids)
+	}
+	if keyShares[0].Name != "c" || keyShares[1].Name != "a" || keyShares[4].Name != "b" {
+		t.Errorf("key shares should be assigned to the participants of their ids")
+	}
+}
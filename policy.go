@@ -0,0 +1,357 @@
+package tcrsa
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// policyNode is a node of a monotone access structure. A leaf is a participant, and an inner node is satisfied
+// when at least threshold of its children are satisfied. The and and or operators are thresholds of all the
+// children and of one of them respectively.
+type policyNode struct {
+	threshold int           // Number of children needed. Zero for leaves.
+	children  []*policyNode // Children of an inner node.
+	name      string        // Participant name of a leaf.
+	id        uint16        // Key share id of a leaf.
+}
+
+// parsePolicy parses an access structure policy. A policy is a participant name, or one of the operators
+// thresh(t, p1, ..., pn), and(p1, ..., pn) and or(p1, ..., pn) applied to other policies, such as
+// "and(thresh(2, alice, bob, carol), thresh(3, dave, erin, frank, grace, heidi))". Participant names are
+// made of letters, digits and the characters "_.:@-", and every participant must appear only once.
+// The ids of the key shares of the participants are assigned in the order they appear in the policy.
+// It returns the root of the policy, or an error if the policy is not valid.
+func parsePolicy(policy string) (*policyNode, error) {
+	p := &policyParser{input: policy}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos != len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+	leaves := root.leaves()
+	if len(leaves) > maxPolicyLeaves {
+		return nil, fmt.Errorf("policy has %d participants, but it should have at most %d", len(leaves), maxPolicyLeaves)
+	}
+	names := make(map[string]bool, len(leaves))
+	for i, leaf := range leaves {
+		if names[leaf.name] {
+			return nil, fmt.Errorf("participant %q appears more than once in the policy", leaf.name)
+		}
+		names[leaf.name] = true
+		leaf.id = uint16(i + 1)
+	}
+	return root, nil
+}
+
+// Maximum number of participants of a policy.
+const maxPolicyLeaves = 1 << 12
+
+// policyParser is a recursive descent parser of policies.
+type policyParser struct {
+	input string
+	pos   int
+}
+
+// errorf returns a parsing error at the current position.
+func (p *policyParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid policy at position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *policyParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// expect consumes the character c, skipping the spaces before it.
+func (p *policyParser) expect(c byte) error {
+	p.skipSpaces()
+	if p.pos >= len(p.input) || p.input[p.pos] != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// token returns the next name or number.
+func (p *policyParser) token() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := rune(p.input[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("_.:@-", c) || c > unicode.MaxASCII {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// parse parses a policy node.
+func (p *policyParser) parse() (*policyNode, error) {
+	name := p.token()
+	if name == "" {
+		return nil, p.errorf("expected a participant name or an operator")
+	}
+	p.skipSpaces()
+	if p.pos >= len(p.input) || p.input[p.pos] != '(' {
+		return &policyNode{name: name}, nil
+	}
+	p.pos++
+	node := &policyNode{}
+	switch name {
+	case "thresh":
+		t := p.token()
+		threshold, err := strconv.Atoi(t)
+		if err != nil {
+			return nil, p.errorf("invalid threshold %q", t)
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		node.threshold = threshold
+	case "and", "or":
+	default:
+		return nil, p.errorf("unknown operator %q", name)
+	}
+	for {
+		child, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, child)
+		p.skipSpaces()
+		if p.pos < len(p.input) && p.input[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		break
+	}
+	switch name {
+	case "and":
+		node.threshold = len(node.children)
+	case "or":
+		node.threshold = 1
+	}
+	if node.threshold < 1 || node.threshold > len(node.children) {
+		return nil, p.errorf("threshold should be between 1 and %d, but it is %d", len(node.children), node.threshold)
+	}
+	return node, nil
+}
+
+// String returns the canonical form of the policy, with all the operators written as thresholds.
+func (node *policyNode) String() string {
+	if node.children == nil {
+		return node.name
+	}
+	parts := make([]string, len(node.children)+1)
+	parts[0] = strconv.Itoa(node.threshold)
+	for i, child := range node.children {
+		parts[i+1] = child.String()
+	}
+	return "thresh(" + strings.Join(parts, ",") + ")"
+}
+
+// leaves returns the leaves of the policy, from left to right.
+func (node *policyNode) leaves() []*policyNode {
+	if node.children == nil {
+		return []*policyNode{node}
+	}
+	var leaves []*policyNode
+	for _, child := range node.children {
+		leaves = append(leaves, child.leaves()...)
+	}
+	return leaves
+}
+
+// minSigners returns the size of the smallest set of participants that satisfies the policy.
+func (node *policyNode) minSigners() int {
+	if node.children == nil {
+		return 1
+	}
+	mins := make([]int, len(node.children))
+	for i, child := range node.children {
+		mins[i] = child.minSigners()
+	}
+	// Sum of the threshold smallest values.
+	for i := range mins {
+		for j := i + 1; j < len(mins); j++ {
+			if mins[j] < mins[i] {
+				mins[i], mins[j] = mins[j], mins[i]
+			}
+		}
+	}
+	total := 0
+	for _, min := range mins[:node.threshold] {
+		total += min
+	}
+	return total
+}
+
+// deal shares the secret among the leaves of the policy, setting values[id-1] to the share of the leaf with
+// each id. Every inner node with n children shares its value a with a random polynomial f of degree
+// threshold-1 modulo m, with f(0) = a * (n!)^-1, and the child j receives f(j). Then any set of children
+// above the threshold recovers a as the sum of their values multiplied by the integer coefficients n! * L_j(0).
+func (node *policyNode) deal(secret, m *big.Int, values []*big.Int) error {
+	if node.children == nil {
+		values[node.id-1] = secret
+		return nil
+	}
+	deltaInv := new(big.Int).MulRange(1, int64(len(node.children)))
+	if deltaInv.ModInverse(deltaInv, m) == nil {
+		return fmt.Errorf("%d! is not invertible", len(node.children))
+	}
+	f0 := new(big.Int).Mul(secret, deltaInv)
+	f0.Mod(f0, m)
+	poly, err := createRandomPolynomial(node.threshold-1, f0, m)
+	if err != nil {
+		return err
+	}
+	defer poly.wipe()
+	defer wipeInts(f0)
+	for j, child := range node.children {
+		if err := child.deal(poly.evalMod(big.NewInt(int64(j+1)), m), m, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coefficients returns the integer coefficients c_i of the shares of a minimal subset of the signers provided
+// that satisfies the policy, such that the secret is the sum of c_i * s_i. For every inner node, the first
+// threshold satisfied children are used.
+// It returns false if the signers do not satisfy the policy.
+func (node *policyNode) coefficients(signers map[uint16]bool) (map[uint16]*big.Int, bool) {
+	if node.children == nil {
+		if !signers[node.id] {
+			return nil, false
+		}
+		return map[uint16]*big.Int{node.id: big.NewInt(1)}, true
+	}
+	points := make([]int64, 0, node.threshold)
+	childCoefficients := make([]map[uint16]*big.Int, 0, node.threshold)
+	for j, child := range node.children {
+		if len(points) == node.threshold {
+			break
+		}
+		if c, ok := child.coefficients(signers); ok {
+			points = append(points, int64(j+1))
+			childCoefficients = append(childCoefficients, c)
+		}
+	}
+	if len(points) < node.threshold {
+		return nil, false
+	}
+	// lambda_j = n! * L_j(0), which is an integer because the points are between 1 and n.
+	mus, d, _ := lagrangeCoefficients(points, 0)
+	delta := new(big.Int).MulRange(1, int64(len(node.children)))
+	delta.Quo(delta, d)
+	result := make(map[uint16]*big.Int)
+	for j, c := range childCoefficients {
+		lambda := mus[j].Mul(mus[j], delta)
+		for id, cj := range c {
+			result[id] = cj.Mul(cj, lambda)
+		}
+	}
+	return result, true
+}
+
+// parsePolicy parses the access structure policy of the key meta information.
+// It returns nil if the key has no policy, or an error if the policy is invalid or it does not match the
+// threshold, the number of shares or the participants of the key.
+func (keyMeta *KeyMeta) parsePolicy() (*policyNode, error) {
+	if keyMeta.Policy == "" {
+		return nil, nil
+	}
+	policy, err := parsePolicy(keyMeta.Policy)
+	if err != nil {
+		return nil, err
+	}
+	leaves := policy.leaves()
+	if len(leaves) != int(keyMeta.L) {
+		return nil, fmt.Errorf("policy has %d participants, but the key has %d shares", len(leaves), keyMeta.L)
+	}
+	if min := policy.minSigners(); min != int(keyMeta.K) {
+		return nil, fmt.Errorf("policy needs at least %d signers, but the threshold of the key is %d", min, keyMeta.K)
+	}
+	if len(keyMeta.Participants) != len(leaves) {
+		return nil, fmt.Errorf("policy has %d participants, but the key has %d", len(leaves), len(keyMeta.Participants))
+	}
+	for i, leaf := range leaves {
+		participant := keyMeta.Participants[i]
+		if participant.Name != leaf.name || participant.Id != leaf.id || participant.weight() != 1 {
+			return nil, fmt.Errorf("participant %q with id %d does not match the policy", participant.Name, participant.Id)
+		}
+	}
+	return policy, nil
+}
+
+// selectSigners returns the positions of the signers that join a signature, given the ids of the available
+// signers, which should be at least k. Without a policy, they are the first k signers. With a policy, they are
+// a minimal subset of the signers that satisfies it.
+// It returns an error if the ids are repeated or they do not satisfy the policy.
+func (prepared *PreparedKeyMeta) selectSigners(ids []uint16) ([]int, error) {
+	if prepared.policy == nil {
+		positions := make([]int, prepared.K)
+		for i := range positions {
+			positions[i] = i
+		}
+		return positions, nil
+	}
+	signers := make(map[uint16]bool, len(ids))
+	for _, id := range ids {
+		if signers[id] {
+			return nil, fmt.Errorf("there is more than one share with id %d", id)
+		}
+		signers[id] = true
+	}
+	coefficients, ok := prepared.policy.coefficients(signers)
+	if !ok {
+		return nil, fmt.Errorf("signers do not satisfy the policy %s", prepared.Policy)
+	}
+	positions := make([]int, 0, len(coefficients))
+	for i, id := range ids {
+		if _, ok := coefficients[id]; ok {
+			positions = append(positions, i)
+		}
+	}
+	return positions, nil
+}
+
+// policyJoinCoefficients returns the coefficients to join the shares of a minimal set of signers with the ids
+// provided that satisfies the policy. The secret is the sum of the integer coefficients of the policy multiplied
+// by the key shares, so there is no delta factor, and the exponent of the product of the shares is a, where a
+// and b satisfy 4*a + e*b = 1.
+// It returns an error if the signers do not satisfy the policy or some of them are not needed.
+func (prepared *PreparedKeyMeta) policyJoinCoefficients(ids []uint16) (*joinCoefficients, error) {
+	signers := make(map[uint16]bool, len(ids))
+	for _, id := range ids {
+		signers[id] = true
+	}
+	policyCoefficients, ok := prepared.policy.coefficients(signers)
+	if !ok {
+		return nil, fmt.Errorf("signers do not satisfy the policy %s", prepared.Policy)
+	}
+	if len(policyCoefficients) != len(ids) {
+		return nil, fmt.Errorf("signers are not a minimal set that satisfies the policy %s", prepared.Policy)
+	}
+	coefficients := &joinCoefficients{
+		lambdas2: make(map[uint16]*big.Int, len(ids)),
+		tA:       new(big.Int),
+		b:        new(big.Int),
+	}
+	new(big.Int).GCD(coefficients.tA, coefficients.b, big.NewInt(4), prepared.e)
+	for id, c := range policyCoefficients {
+		coefficients.lambdas2[id] = c.Lsh(c, 1)
+	}
+	return coefficients, nil
+}
@@ -0,0 +1,187 @@
+package tcrsa_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+const policyTestPolicy = "and(thresh(2, exec1, exec2, exec3), thresh(3, eng1, eng2, eng3, eng4, eng5))"
+
+// policyKey creates the key defined by the fixed test values in key_test.go with the policy provided, and signs
+// the first test document with all its shares.
+func policyKey(t *testing.T, policy string) (*tcrsa.KeyMeta, []byte, []byte, map[string]*tcrsa.SigShare) {
+	keyShares, keyMeta, err := tcrsa.NewKeyWithPolicy(keyTestFixedSize, policy, fixedKeyArgs(t))
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	docs, hashes := batchDocs(t, 1, keyMeta)
+	sigShares := make(map[string]*tcrsa.SigShare, len(keyShares))
+	for _, keyShare := range keyShares {
+		sigShare, err := keyShare.Sign(docs[0], keyTestHashType, keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := sigShare.Verify(docs[0], keyMeta); err != nil {
+			t.Errorf("%v", err)
+		}
+		sigShares[keyShare.Name] = sigShare
+	}
+	return keyMeta, docs[0], hashes[0], sigShares
+}
+
+// policySigners returns the signature shares of the participants provided.
+func policySigners(sigShares map[string]*tcrsa.SigShare, names ...string) tcrsa.SigShareList {
+	list := make(tcrsa.SigShareList, len(names))
+	for i, name := range names {
+		list[i] = sigShares[name]
+	}
+	return list
+}
+
+func TestNewKeyWithPolicy(t *testing.T) {
+	keyMeta, doc, hash, sigShares := policyKey(t, policyTestPolicy)
+	if keyMeta.K != 5 || keyMeta.L != 8 {
+		t.Errorf("key should have k=5 and l=8, but it has k=%d and l=%d", keyMeta.K, keyMeta.L)
+	}
+	if expected := "thresh(2,thresh(2,exec1,exec2,exec3),thresh(3,eng1,eng2,eng3,eng4,eng5))"; keyMeta.Policy != expected {
+		t.Errorf("policy should be %s, but it is %s", expected, keyMeta.Policy)
+	}
+
+	for _, names := range [][]string{
+		{"exec1", "exec3", "eng2", "eng4", "eng5"},
+		{"eng5", "exec2", "eng1", "exec1", "eng3"},
+		{"exec1", "exec2", "exec3", "eng1", "eng2", "eng3", "eng4", "eng5"},
+	} {
+		signature, err := policySigners(sigShares, names...).Join(doc, keyMeta)
+		if err != nil {
+			t.Errorf("signers %v should satisfy the policy: %v", names, err)
+			continue
+		}
+		if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, hash, signature); err != nil {
+			t.Errorf("signature of %v is invalid: %v", names, err)
+		}
+	}
+
+	for _, names := range [][]string{
+		{"exec1", "exec2", "exec3", "eng1", "eng2"},
+		{"exec1", "eng1", "eng2", "eng3", "eng4", "eng5"},
+		{"exec1", "exec2", "eng1", "eng2"},
+	} {
+		if _, err := policySigners(sigShares, names...).Join(doc, keyMeta); err == nil {
+			t.Errorf("signers %v should not satisfy the policy", names)
+		}
+	}
+
+	all := policySigners(sigShares, "exec1", "exec2", "exec3", "eng1", "eng2", "eng3", "eng4", "eng5")
+	if _, err := all.BatchVerify(doc, keyMeta); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestNewKeyWithPolicy_or(t *testing.T) {
+	keyMeta, doc, hash, sigShares := policyKey(t, "or(and(alice, bob), thresh(2, carol, dave, erin))")
+	if keyMeta.K != 2 || keyMeta.L != 5 {
+		t.Errorf("key should have k=2 and l=5, but it has k=%d and l=%d", keyMeta.K, keyMeta.L)
+	}
+	for _, names := range [][]string{{"alice", "bob"}, {"erin", "carol"}, {"alice", "dave", "erin"}} {
+		signature, err := policySigners(sigShares, names...).Join(doc, keyMeta)
+		if err != nil {
+			t.Errorf("signers %v should satisfy the policy: %v", names, err)
+			continue
+		}
+		if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, hash, signature); err != nil {
+			t.Errorf("signature of %v is invalid: %v", names, err)
+		}
+	}
+	for _, names := range [][]string{{"alice", "carol"}, {"bob", "erin"}} {
+		if _, err := policySigners(sigShares, names...).Join(doc, keyMeta); err == nil {
+			t.Errorf("signers %v should not satisfy the policy", names)
+		}
+	}
+}
+
+func TestNewKeyWithPolicy_batch(t *testing.T) {
+	keyShares, keyMeta, err := tcrsa.NewKeyWithPolicy(keyTestFixedSize, "thresh(2, and(a, b), c, d)", fixedKeyArgs(t))
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	docs, hashes := batchDocs(t, 4, keyMeta)
+	batches := make(tcrsa.BatchSigShareList, 0, 3)
+	for _, keyShare := range keyShares[1:] {
+		batch, err := keyShare.SignBatch(docs, keyTestHashType, keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		batches = append(batches, batch)
+	}
+	// The signatures are joined with the shares of c and d, as b cannot sign without a.
+	signatures, err := batches.Join(docs, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for j, signature := range signatures {
+		if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, hashes[j], signature); err != nil {
+			t.Errorf("signature %d is invalid: %v", j, err)
+		}
+	}
+	if _, err := batches[:2].Join(docs, keyMeta); err == nil {
+		t.Errorf("b and c should not satisfy the policy")
+	}
+}
+
+func TestNewKeyWithPolicy_invalid(t *testing.T) {
+	for _, policy := range []string{
+		"",
+		"alice",
+		"and(alice)",
+		"thresh(0, alice, bob)",
+		"thresh(3, alice, bob)",
+		"thresh(x, alice, bob)",
+		"and(alice, bob",
+		"and(alice, bob))",
+		"and(alice, , bob)",
+		"xor(alice, bob)",
+		"and(alice, or(bob, alice))",
+		"and(alice, böb)",
+	} {
+		if _, _, err := tcrsa.NewKeyWithPolicy(keyTestFixedSize, policy, fixedKeyArgs(t)); err == nil {
+			t.Errorf("policy %q should be invalid", policy)
+		}
+	}
+	args := fixedKeyArgs(t)
+	args.Participants = []string{"alice", "bob"}
+	if _, _, err := tcrsa.NewKeyWithPolicy(keyTestFixedSize, "and(alice, bob)", args); err == nil {
+		t.Errorf("participants should be defined only by the policy")
+	}
+}
+
+func TestKeyMeta_policyMismatch(t *testing.T) {
+	_, keyMeta, err := tcrsa.NewKeyWithPolicy(keyTestFixedSize, "thresh(2, alice, bob, carol)", fixedKeyArgs(t))
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	keyID, err := keyMeta.ID()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	policy := keyMeta.Policy
+	keyMeta.Policy = "thresh(2,bob,alice,carol)"
+	if _, err := keyMeta.Prepare(); err == nil {
+		t.Errorf("policy with participants in a different order should be invalid")
+	}
+	keyMeta.Policy = "thresh(3,alice,bob,carol)"
+	if _, err := keyMeta.Prepare(); err == nil {
+		t.Errorf("policy with a different threshold should be invalid")
+	}
+	keyMeta.Policy = ""
+	if _, err := keyMeta.Prepare(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	thresholdID, _ := keyMeta.ID()
+	if thresholdID.Equal(keyID) {
+		t.Errorf("key identifier should depend on the policy")
+	}
+	keyMeta.Policy = policy
+}
@@ -43,6 +43,7 @@ func createRandomPolynomial(d int, x0, m *big.Int) (polynomial, error) {
 			return polynomial{}, err
 		}
 		poly[i].Mod(rand, m)
+		wipeInts(rand)
 	}
 	return poly, nil
 }
@@ -74,6 +75,23 @@ func (p polynomial) eval(x *big.Int) *big.Int {
 	return y
 }
 
+// evalMod evaluates a polynomial to x modulo m with Horner's method and returns the result. The intermediate
+// values are reduced, so their size does not grow with the degree of the polynomial.
+func (p polynomial) evalMod(x, m *big.Int) *big.Int {
+	y := big.NewInt(0)
+	for k := len(p) - 1; k >= 0; k-- {
+		y.Mul(y, x)
+		y.Add(y, p[k])
+		y.Mod(y, m)
+	}
+	return y
+}
+
+// wipe overwrites the coefficients of the polynomial with zeros.
+func (p polynomial) wipe() {
+	wipeInts(p...)
+}
+
 // string returns the polynomial formatted as a string.
 func (p polynomial) String() string {
 	s := make([]string, len(p))
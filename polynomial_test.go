@@ -42,3 +42,19 @@ func TestPolynomial_Eval(t *testing.T) {
 		t.Errorf("The evaluations is not providing a correct result")
 	}
 }
+
+func TestPolynomial_EvalMod(t *testing.T) {
+	p := newPolynomial(polynomialTestDegree)
+	p[3] = big.NewInt(7)
+	p[2] = big.NewInt(5)
+	p[1] = big.NewInt(9)
+	p[0] = big.NewInt(1)
+
+	expected := big.NewInt(7591 % 1000)
+
+	res := p.evalMod(big.NewInt(10), big.NewInt(1000))
+
+	if expected.Cmp(res) != 0 {
+		t.Errorf("The modular evaluation is not providing a correct result")
+	}
+}
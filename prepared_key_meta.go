@@ -0,0 +1,175 @@
+package tcrsa
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// MetaInfo is the key meta information accepted by Sign, Verify and Join. It is implemented by KeyMeta,
+// which is parsed on every call, and by PreparedKeyMeta, which keeps the parsed values between calls.
+type MetaInfo interface {
+	prepare() (*PreparedKeyMeta, error)
+}
+
+// PreparedKeyMeta is a KeyMeta with its values parsed as big numbers, u^e mod n already computed, a
+// fixed-base exponentiation table for V and a cache of the coefficients used to join the shares of the last
+// signer subsets. It should be created once with KeyMeta.Prepare and reused for
+// every signing, verification and joining operation of the key.
+// It can be shared between goroutines. The KeyMeta it was created
+// from should not be modified after that.
+type PreparedKeyMeta struct {
+	*KeyMeta
+	n      *big.Int    // Modulus.
+	e      *big.Int    // Public exponent.
+	v      *big.Int    // Verification value V.
+	u      *big.Int    // Verification value U.
+	ue     *big.Int    // u^e mod n
+	invU   *big.Int    // u^-1 mod n
+	vk     []*big.Int  // Verification values of the shares.
+	proof  ProofParams // Proof parameters, with the default values set.
+	keyID  KeyID       // Identifier of the key.
+	vTable *fixedBaseTable
+	ctN    *ctModulus // Modulus prepared for the constant-time operations with the key shares.
+
+	participants map[string]Participant // Participants by name.
+	owners       map[uint16]string      // Participant names by key share id.
+	policy       *policyNode            // Parsed access structure policy, or nil for k-of-l keys.
+
+	lagrangeMutex sync.Mutex                   // Protects lagrangeCache.
+	lagrangeCache map[string]*joinCoefficients // Join coefficients of the last signer subsets.
+}
+
+// Prepare parses the key meta information and precomputes the values used on each signing, verification and
+// joining operation.
+// It returns the prepared key meta information, or an error if the key meta information is invalid.
+func (keyMeta *KeyMeta) Prepare() (*PreparedKeyMeta, error) {
+	prepared, err := keyMeta.prepare()
+	if err != nil {
+		return nil, err
+	}
+	// The exponents used with V are the public z values of the proofs, which have at most one more bit than
+	// their random values. The random values are secret, so their powers are computed in constant time instead.
+	prepared.vTable = newFixedBaseTable(prepared.v, prepared.n, prepared.proof.randomBits(prepared.n.BitLen())+1)
+	return prepared, nil
+}
+
+// prepare parses the key meta information, without precomputing the fixed-base tables.
+func (keyMeta *KeyMeta) prepare() (*PreparedKeyMeta, error) {
+	if keyMeta == nil {
+		return nil, fmt.Errorf("key metainfo is nil")
+	}
+	if keyMeta.PublicKey == nil || keyMeta.PublicKey.N == nil {
+		return nil, fmt.Errorf("public key is nil")
+	}
+	if keyMeta.VerificationKey == nil {
+		return nil, fmt.Errorf("verification key is nil")
+	}
+	if len(keyMeta.VerificationKey.I) != int(keyMeta.L) {
+		return nil, fmt.Errorf("verification key has %d values, but it should have %d", len(keyMeta.VerificationKey.I), keyMeta.L)
+	}
+	participants, err := participantsByName(keyMeta.Participants, keyMeta.L)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMode(keyMeta.Mode, keyMeta.K, keyMeta.L); err != nil {
+		return nil, err
+	}
+	if err := checkVerificationMode(keyMeta.Verification); err != nil {
+		return nil, err
+	}
+	policy, err := keyMeta.parsePolicy()
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil && keyMeta.Mode != ShamirSharing {
+		return nil, fmt.Errorf("policy keys cannot use %s sharing mode", keyMeta.Mode)
+	}
+	n := new(big.Int).Set(keyMeta.PublicKey.N)
+	proof, err := keyMeta.ProofParams.resolve(n.BitLen())
+	if err != nil {
+		return nil, err
+	}
+	prepared := &PreparedKeyMeta{
+		KeyMeta: keyMeta,
+		n:       n,
+		e:       new(big.Int).SetUint64(uint64(keyMeta.PublicKey.E)),
+		v:       new(big.Int).SetBytes(keyMeta.VerificationKey.V),
+		u:       new(big.Int).SetBytes(keyMeta.VerificationKey.U),
+		vk:      make([]*big.Int, keyMeta.L),
+		proof:   proof,
+
+		participants: participants,
+		owners:       make(map[uint16]string),
+		policy:       policy,
+	}
+	for _, participant := range keyMeta.Participants {
+		for j := uint16(0); j < participant.weight(); j++ {
+			prepared.owners[participant.Id+j] = participant.Name
+		}
+	}
+	ctN, err := newCtModulus(n)
+	if err != nil {
+		return nil, err
+	}
+	prepared.ctN = ctN
+	prepared.ue = new(big.Int).Exp(prepared.u, prepared.e, n)
+	prepared.invU = new(big.Int).ModInverse(prepared.u, n)
+	if prepared.invU == nil {
+		return nil, fmt.Errorf("verification value u is not invertible")
+	}
+	for i, vki := range keyMeta.VerificationKey.I {
+		prepared.vk[i] = new(big.Int).SetBytes(vki)
+	}
+	prepared.keyID = prepared.computeKeyID()
+	return prepared, nil
+}
+
+// prepare returns the prepared key meta information itself.
+func (prepared *PreparedKeyMeta) prepare() (*PreparedKeyMeta, error) {
+	if prepared == nil || prepared.n == nil {
+		return nil, fmt.Errorf("key metainfo is nil or it was not created with KeyMeta.Prepare")
+	}
+	return prepared, nil
+}
+
+// verificationKey returns the verification value of the share with the id provided.
+func (prepared *PreparedKeyMeta) verificationKey(id uint16) (*big.Int, error) {
+	if id < 1 || id > prepared.L {
+		return nil, fmt.Errorf("id should be between 1 and %d, but it is %d", prepared.L, id)
+	}
+	return prepared.vk[id-1], nil
+}
+
+// multiExpV returns v^x * prod(bases[i]^exps[i]) mod n. The power of v uses the fixed-base table if the key meta
+// information was prepared with one, and is computed together with the other powers if it was not.
+func (prepared *PreparedKeyMeta) multiExpV(x *big.Int, bases, exps []*big.Int) (*big.Int, error) {
+	if prepared.vTable == nil {
+		return multiExp(append([]*big.Int{prepared.v}, bases...), append([]*big.Int{x}, exps...), prepared.n)
+	}
+	result, err := multiExp(bases, exps, prepared.n)
+	if err != nil {
+		return nil, err
+	}
+	return result.Mul(result, prepared.vTable.exp(x)).Mod(result, prepared.n), nil
+}
+
+// adjustDocument returns the document as a number, multiplied by u^e if its jacobi symbol is -1, and
+// whether it was multiplied.
+func (prepared *PreparedKeyMeta) adjustDocument(doc []byte) (x *big.Int, jacobied bool) {
+	x = new(big.Int).SetBytes(doc)
+	// x = doc if (doc | n) == 1 else doc * u^e
+	if big.Jacobi(x, prepared.n) == -1 {
+		x.Mul(x, prepared.ue).Mod(x, prepared.n)
+		jacobied = true
+	}
+	return
+}
+
+// prepareMetaInfo returns the prepared form of info, or an error if it is nil or invalid.
+func prepareMetaInfo(info MetaInfo) (*PreparedKeyMeta, error) {
+	if info == nil {
+		return nil, fmt.Errorf("key metainfo is nil")
+	}
+	return info.prepare()
+}
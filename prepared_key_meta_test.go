@@ -0,0 +1,149 @@
+package tcrsa_test
+
+import (
+	"crypto/rsa"
+	"github.com/niclabs/tcrsa"
+	"sync"
+	"testing"
+)
+
+const preparedTestGoroutines = 4
+
+func TestPreparedKeyMeta(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	prepared, err := keyMeta.Prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	docs, hashes := batchDocs(t, preparedTestGoroutines, keyMeta)
+
+	// The prepared key meta information is shared by all the goroutines.
+	var wg sync.WaitGroup
+	wg.Add(len(docs))
+	for j := range docs {
+		go func(doc, hash []byte) {
+			defer wg.Done()
+			sigShares := make(tcrsa.SigShareList, len(keyShares))
+			for i, keyShare := range keyShares {
+				var err error
+				sigShares[i], err = keyShare.Sign(doc, keyTestHashType, prepared)
+				if err != nil {
+					t.Errorf("%v", err)
+					return
+				}
+				// Both forms of the key meta information must accept the share.
+				if err := sigShares[i].Verify(doc, prepared); err != nil {
+					t.Errorf("%v", err)
+				}
+				if err := sigShares[i].Verify(doc, keyMeta); err != nil {
+					t.Errorf("%v", err)
+				}
+			}
+			signature, err := sigShares.Join(doc, prepared)
+			if err != nil {
+				t.Errorf("%v", err)
+				return
+			}
+			if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, keyTestHashType, hash, signature); err != nil {
+				t.Errorf("%v", err)
+			}
+		}(docs[j], hashes[j])
+	}
+	wg.Wait()
+}
+
+func TestPreparedKeyMeta_invalid(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	docs, _ := batchDocs(t, 1, keyMeta)
+
+	var nilMeta *tcrsa.KeyMeta
+	if _, err := keyShares[0].Sign(docs[0], keyTestHashType, nilMeta); err == nil {
+		t.Errorf("signing with nil key metainfo should fail")
+	}
+	if _, err := keyShares[0].Sign(docs[0], keyTestHashType, &tcrsa.PreparedKeyMeta{}); err == nil {
+		t.Errorf("signing with a key metainfo not created with Prepare should fail")
+	}
+	keyShare := *keyShares[0]
+	keyShare.Id = keyMeta.L + 1
+	if _, err := keyShare.Sign(docs[0], keyTestHashType, keyMeta); err == nil {
+		t.Errorf("signing with an id out of range should fail")
+	}
+}
+
+func BenchmarkSign_keyMeta(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	docs, _ := batchDocs(b, 1, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := keyShares[0].Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkSign_prepared(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	prepared, err := keyMeta.Prepare()
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	docs, _ := batchDocs(b, 1, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := keyShares[0].Sign(docs[0], keyTestHashType, prepared); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkVerify_keyMeta(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	doc, sigShares := listSigShares(b, keyShares, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := sigShares[0].Verify(doc, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkVerify_prepared(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	prepared, err := keyMeta.Prepare()
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	doc, sigShares := listSigShares(b, keyShares, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := sigShares[0].Verify(doc, prepared); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkJoin_keyMeta(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	doc, sigShares := listSigShares(b, keyShares, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sigShares.Join(doc, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkJoin_prepared(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	prepared, err := keyMeta.Prepare()
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	doc, sigShares := listSigShares(b, keyShares, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sigShares.Join(doc, prepared); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package tcrsa
+
+import (
+	"crypto"
+	"fmt"
+	"math/big"
+)
+
+// Default values of the proof parameters.
+const (
+	defaultProofHash          = crypto.SHA256
+	defaultProofChallengeBits = 256
+	defaultProofHidingBits    = 128
+)
+
+// Minimum values of the proof parameters.
+const (
+	minProofChallengeBits = 128
+	minProofHidingBits    = 64
+)
+
+// ProofParams defines the parameters of the correctness proofs of the signature shares. The zero value of each
+// field is replaced by its default value, so the zero ProofParams uses SHA-256, 256 bit challenges and 128 bits
+// of statistical hiding.
+type ProofParams struct {
+	// Hash function used to compute the challenges. It must be linked into the binary: SHA3 functions are
+	// available after importing a package which registers them, such as crypto/sha3 or golang.org/x/crypto/sha3.
+	Hash crypto.Hash
+	// Bit length of the challenges, at most the output size of Hash. The soundness error of a proof is 2^-ChallengeBits.
+	ChallengeBits int
+	// Statistical hiding parameter. The random value of a proof has HidingBits more bits than the product of the
+	// challenge and the key share, so the proof leaks at most 2^-HidingBits about the key share.
+	HidingBits int
+}
+
+// resolve returns the parameters with the default values set, checking them for a modulus of nBits bits.
+// It returns an error if the hash function is not available or any bit length is out of range.
+func (params ProofParams) resolve(nBits int) (ProofParams, error) {
+	if params.Hash == 0 {
+		params.Hash = defaultProofHash
+	}
+	if params.ChallengeBits == 0 {
+		params.ChallengeBits = defaultProofChallengeBits
+	}
+	if params.HidingBits == 0 {
+		params.HidingBits = defaultProofHidingBits
+	}
+	if !params.Hash.Available() {
+		return ProofParams{}, fmt.Errorf("proof hash function %d is not available", params.Hash)
+	}
+	maxChallengeBits := params.Hash.Size() * 8
+	if maxChallengeBits >= nBits {
+		maxChallengeBits = nBits - 1
+	}
+	if params.ChallengeBits < minProofChallengeBits || params.ChallengeBits > maxChallengeBits {
+		return ProofParams{}, fmt.Errorf("proof challenge bits should be between %d and %d, but they are %d", minProofChallengeBits, maxChallengeBits, params.ChallengeBits)
+	}
+	if params.HidingBits < minProofHidingBits {
+		return ProofParams{}, fmt.Errorf("proof hiding bits should be at least %d, but they are %d", minProofHidingBits, params.HidingBits)
+	}
+	return params, nil
+}
+
+// randomBits returns the bit length of the random values of the proofs for a modulus of nBits bits.
+// The key shares are lower than the modulus.
+func (params ProofParams) randomBits(nBits int) int {
+	return nBits + params.ChallengeBits + params.HidingBits
+}
+
+// challenge returns the challenge defined by the sum of a challenge hash, truncated to its first ChallengeBits bits.
+func (params ProofParams) challenge(sum []byte) *big.Int {
+	c := new(big.Int).SetBytes(sum)
+	return c.Rsh(c, uint(len(sum)*8-params.ChallengeBits))
+}
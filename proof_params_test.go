@@ -0,0 +1,87 @@
+package tcrsa_test
+
+import (
+	"crypto"
+	_ "crypto/sha512"
+	"github.com/niclabs/tcrsa"
+	"testing"
+)
+
+func TestProofParams(t *testing.T) {
+	for _, params := range []tcrsa.ProofParams{
+		{},
+		{Hash: crypto.SHA512},
+		{Hash: crypto.SHA512, ChallengeBits: 200, HidingBits: 80},
+		{Hash: crypto.SHA384, ChallengeBits: 384, HidingBits: 256},
+	} {
+		args := fixedKeyArgs(t)
+		args.ProofParams = params
+		keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		docs, _ := batchDocs(t, 2, keyMeta)
+		// The document hash type does not change the proof.
+		for _, hashType := range []crypto.Hash{0, crypto.SHA256, crypto.SHA512} {
+			sigShare, err := keyShares[0].Sign(docs[0], hashType, keyMeta)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := sigShare.Verify(docs[0], keyMeta); err != nil {
+				t.Errorf("params %+v: %v", keyMeta.ProofParams, err)
+			}
+			zBits := keyMeta.PublicKey.N.BitLen() + keyMeta.ProofParams.ChallengeBits + keyMeta.ProofParams.HidingBits + 1
+			if len(sigShare.Z) > (zBits+7)/8 {
+				t.Errorf("params %+v: z has %d bytes, but it should have at most %d bits", keyMeta.ProofParams, len(sigShare.Z), zBits)
+			}
+
+			// The proof is not valid with other parameters.
+			other := *keyMeta
+			other.ProofParams.Hash = crypto.SHA256
+			if keyMeta.ProofParams.Hash == crypto.SHA256 {
+				other.ProofParams.Hash = crypto.SHA512
+			}
+			if err := sigShare.Verify(docs[0], &other); err == nil {
+				t.Errorf("params %+v: proof should not be valid with other hash function", keyMeta.ProofParams)
+			}
+		}
+
+		batch, err := keyShares[1].SignBatch(docs, 0, keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := batch.Verify(docs, keyMeta); err != nil {
+			t.Errorf("params %+v: %v", keyMeta.ProofParams, err)
+		}
+	}
+}
+
+func TestProofParams_defaults(t *testing.T) {
+	_, keyMeta := fixedKey(t)
+	expected := tcrsa.ProofParams{Hash: crypto.SHA256, ChallengeBits: 256, HidingBits: 128}
+	if keyMeta.ProofParams != expected {
+		t.Errorf("proof params should be %+v, but they are %+v", expected, keyMeta.ProofParams)
+	}
+}
+
+func TestProofParams_invalid(t *testing.T) {
+	for _, params := range []tcrsa.ProofParams{
+		{Hash: crypto.MD4},
+		{Hash: crypto.SHA256, ChallengeBits: 257},
+		{ChallengeBits: 64},
+		{HidingBits: 32},
+	} {
+		args := fixedKeyArgs(t)
+		args.ProofParams = params
+		if _, _, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args); err == nil {
+			t.Errorf("params %+v should not be accepted", params)
+		}
+	}
+
+	keyShares, keyMeta := fixedKey(t)
+	docs, _ := batchDocs(t, 1, keyMeta)
+	keyMeta.ProofParams.ChallengeBits = 512
+	if _, err := keyShares[0].Sign(docs[0], keyTestHashType, keyMeta); err == nil {
+		t.Errorf("signing with invalid proof params should fail")
+	}
+}
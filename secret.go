@@ -0,0 +1,107 @@
+package tcrsa
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Text shown instead of the value of a SecretBytes.
+const redacted = "[REDACTED]"
+
+// SecretBytes stores secret key material, such as the S_i value of a key share. It redacts itself when it is
+// formatted with the fmt package (and therefore in log output) or marshaled to JSON, so the value must be
+// exported explicitly with Export or ExportBase64 to be stored or sent. It can be wiped with Destroy once it
+// is no longer needed.
+type SecretBytes []byte
+
+// Export returns a copy of the secret value.
+func (s SecretBytes) Export() []byte {
+	return append([]byte{}, s...)
+}
+
+// ExportBase64 returns the secret value encoded in standard Base64.
+func (s SecretBytes) ExportBase64() string {
+	return base64.StdEncoding.EncodeToString(s)
+}
+
+// Equal compares two secret values in constant time and returns true if they are equal.
+// The time taken only depends on the lengths of the values.
+func (s SecretBytes) Equal(s2 SecretBytes) bool {
+	return subtle.ConstantTimeCompare(s, s2) == 1
+}
+
+// Destroy overwrites the secret value with zeros and leaves it empty. Copies of the value made
+// before, such as the ones returned by Export, are not modified.
+func (s *SecretBytes) Destroy() {
+	if s == nil {
+		return
+	}
+	wipeBytes(*s)
+	*s = nil
+}
+
+// String returns a redacted text instead of the secret value.
+func (s SecretBytes) String() string {
+	return redacted
+}
+
+// GoString returns a redacted text instead of the secret value.
+func (s SecretBytes) GoString() string {
+	return redacted
+}
+
+// Format writes a redacted text instead of the secret value for every formatting verb.
+func (s SecretBytes) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redacted)
+}
+
+// MarshalJSON returns a redacted JSON string instead of the secret value.
+func (s SecretBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// UnmarshalJSON sets the secret value from a JSON string with the value encoded in standard Base64,
+// as returned by ExportBase64. It returns an error if the string is redacted or it is not valid Base64.
+func (s *SecretBytes) UnmarshalJSON(data []byte) error {
+	var b64 string
+	if err := json.Unmarshal(data, &b64); err != nil {
+		return err
+	}
+	if b64 == redacted {
+		return fmt.Errorf("secret value is redacted, it should be exported with ExportBase64")
+	}
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return fmt.Errorf("secret value is not valid base64: %v", err)
+	}
+	s.Destroy()
+	*s = b
+	return nil
+}
+
+// wipeBytes overwrites b with zeros.
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// wipeInts overwrites the words of the big numbers with zeros and sets them to zero.
+func wipeInts(xs ...*big.Int) {
+	for _, x := range xs {
+		if x == nil {
+			continue
+		}
+		// The words beyond the length may hold previous values of the number.
+		words := x.Bits()
+		words = words[:cap(words)]
+		for i := range words {
+			words[i] = 0
+		}
+		x.SetInt64(0)
+	}
+}
@@ -0,0 +1,93 @@
+package tcrsa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestSecretBytes_redacted(t *testing.T) {
+	keyShare := &KeyShare{Si: SecretBytes("secret value"), Id: 1}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%x", "%X", "%q", "%d"} {
+		if s := fmt.Sprintf(format, keyShare); strings.Contains(s, "secret") || strings.Contains(s, "736563726574") ||
+			!strings.Contains(s, redacted) {
+			t.Errorf("format %s does not redact the secret value: %s", format, s)
+		}
+	}
+	if s := keyShare.ToBase64(); s != redacted {
+		t.Errorf("ToBase64 should be redacted, but it is %s", s)
+	}
+	b, err := json.Marshal(keyShare)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if strings.Contains(string(b), keyShare.Si.ExportBase64()) || !strings.Contains(string(b), redacted) {
+		t.Errorf("JSON does not redact the secret value: %s", b)
+	}
+	if err := json.Unmarshal(b, &KeyShare{}); err == nil {
+		t.Errorf("a redacted JSON value should not be accepted")
+	}
+}
+
+func TestSecretBytes_export(t *testing.T) {
+	si := SecretBytes("secret value")
+	b, err := json.Marshal(map[string]interface{}{"Si": si.ExportBase64(), "Id": 2})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	keyShare := &KeyShare{}
+	if err := json.Unmarshal(b, keyShare); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(keyShare.Si.Export(), []byte("secret value")) || keyShare.Id != 2 {
+		t.Errorf("key share was not imported from its exported value")
+	}
+	if err := json.Unmarshal([]byte(`{"Si": "not base64!"}`), keyShare); err == nil {
+		t.Errorf("an invalid base64 value should not be accepted")
+	}
+}
+
+func TestSecretBytes_Equal(t *testing.T) {
+	if !SecretBytes("abc").Equal(SecretBytes("abc")) {
+		t.Errorf("equal values should be equal")
+	}
+	for _, other := range []SecretBytes{SecretBytes("abd"), SecretBytes("ab"), nil} {
+		if SecretBytes("abc").Equal(other) {
+			t.Errorf("different values should not be equal")
+		}
+	}
+}
+
+func TestKeyShare_Destroy(t *testing.T) {
+	si := []byte("secret value")
+	keyShare := &KeyShare{Si: si, Id: 1}
+	exported := keyShare.Si.Export()
+	keyShare.Destroy()
+	if len(keyShare.Si) != 0 {
+		t.Errorf("destroyed value should be empty")
+	}
+	if !bytes.Equal(si, make([]byte, len(si))) {
+		t.Errorf("destroyed value was not overwritten with zeros")
+	}
+	if !bytes.Equal(exported, []byte("secret value")) {
+		t.Errorf("exported copy should not be modified")
+	}
+}
+
+func TestWipeInts(t *testing.T) {
+	x := new(big.Int).Lsh(big.NewInt(12345), 300)
+	words := x.Bits()
+	x.SetInt64(7)
+	wipeInts(x, nil)
+	if x.Sign() != 0 {
+		t.Errorf("wiped value should be zero")
+	}
+	for _, word := range words[:cap(words)] {
+		if word != 0 {
+			t.Errorf("wiped value words were not overwritten with zeros")
+		}
+	}
+}
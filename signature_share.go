@@ -1,7 +1,8 @@
 package tcrsa
 
 import (
-	"crypto/sha256"
+	"bytes"
+	"errors"
 	"fmt"
 	"math/big"
 )
@@ -9,55 +10,91 @@ import (
 // SigShare represents a signature share for a document.
 // It can be joined with other k signatures and generate a standard RSA signature.
 type SigShare struct {
-	Xi []byte // Signature share.
-	C  []byte // Verification value.
-	Z  []byte // Verification value
-	Id uint16 // ID of the node which generated the Signature Share.
+	Xi      []byte // Signature share.
+	C       []byte // Verification value.
+	Z       []byte // Verification value
+	Id      uint16 // ID of the node which generated the Signature Share.
+	Name    string // Name of the participant which generated the Signature Share, if the key has participant names.
+	Version uint8  // Format version of the correctness proof (C and Z values).
+
+	// Identifier of the key the share was generated with, and SHA-256 digest of the prepared document it was
+	// generated for. They are empty in the shares generated by previous versions of the library, and then they
+	// are not checked.
+	KeyID     KeyID
+	DocDigest []byte
+
+	Epoch uint32 // Generation of the key share which generated the signature share.
+
+	// Commitments v^r and x~^r of the correctness proof, which let SigShareList.BatchVerify check the proofs of
+	// many signature shares at once. They are empty in the shares generated by previous versions of the
+	// library, and then the share is verified on its own.
+	V []byte
+	X []byte
+
+	// MAC tags of the signature share for every other key share, by id, for keys with MAC verification. They
+	// replace the correctness proof, so C and Z are empty.
+	Tags [][]byte
 }
 
+// Errors returned when a key share or a signature share is used with a key or a document different from the
+// ones it belongs to. They are wrapped with the id of the share.
+var (
+	ErrKeyMismatch      = errors.New("share belongs to a different key")
+	ErrDocumentMismatch = errors.New("signature share was generated for a different document")
+	ErrEpochMismatch    = errors.New("share belongs to a different epoch of the key")
+)
+
 // Signature is the completed signature of a document, created after
 // joining k signature shares.
 type Signature []byte
 
 // Verify verifies that a signature share was generated for the document provided and using a key
-// related to the key metadata provided.
+// related to the key metadata provided. It accepts proofs in the ProofVersion1 format without a context,
+// and in the legacy format.
+// It returns nil if the signature is valid, and an error if it is not.
+func (sigShare SigShare) Verify(doc []byte, info MetaInfo) error {
+	return sigShare.VerifyWithContext(doc, info, nil)
+}
+
+// VerifyWithContext verifies a signature share as Verify, checking that its correctness proof is bound
+// to the context provided. Legacy proofs are not bound to a context, so they are only accepted if the
+// context is empty.
 // It returns nil if the signature is valid, and an error if it is not.
-func (sigShare SigShare) Verify(doc []byte, info *KeyMeta) error {
+func (sigShare SigShare) VerifyWithContext(doc []byte, info MetaInfo, context []byte) error {
 
-	x := new(big.Int)
 	xi := new(big.Int)
 	z := new(big.Int)
 	c := new(big.Int)
-	c2 := new(big.Int)
-	n := new(big.Int)
-	e := new(big.Int)
-	v := new(big.Int)
-	u := new(big.Int)
-	vki := new(big.Int)
 	xTilde := new(big.Int)
 	xi2 := new(big.Int)
-	vPrime := new(big.Int)
-	xPrime := new(big.Int)
 
 	negC := new(big.Int)
-	xiNeg2c := new(big.Int)
-	aux := new(big.Int)
+	negC2 := new(big.Int)
 
-	x.SetBytes(doc)
-	n.Set(info.PublicKey.N)
-	e.SetUint64(uint64(info.PublicKey.E))
-	v.SetBytes(info.VerificationKey.V)
-	u.SetBytes(info.VerificationKey.U)
-	vki.SetBytes(info.VerificationKey.I[sigShare.Id-1])
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return err
+	}
+	if err := meta.checkProofVerification(); err != nil {
+		return err
+	}
+	if sigShare.Id, err = meta.participantId(sigShare.Name, sigShare.Id); err != nil {
+		return err
+	}
+	if err := sigShare.checkBinding(meta, documentDigest(doc)); err != nil {
+		return err
+	}
+	n := meta.n
+	vki, err := meta.verificationKey(sigShare.Id)
+	if err != nil {
+		return err
+	}
 
 	xi.SetBytes(sigShare.Xi)
 	z.SetBytes(sigShare.Z)
 	c.SetBytes(sigShare.C)
 
-	if big.Jacobi(x, n) == -1 {
-		ue := new(big.Int).Exp(u, e, n)
-		x.Mul(x, ue).Mod(x, n)
-	}
+	x, _ := meta.adjustDocument(doc)
 
 	// x~ = x^4 % n
 	xTilde.Exp(x, big.NewInt(4), n)
@@ -67,35 +104,53 @@ func (sigShare SigShare) Verify(doc []byte, info *KeyMeta) error {
 
 	// v' = v^z * v_i^(-c)
 	negC.Neg(c)
-	vPrime.Exp(vki, negC, n)
-	aux.Exp(v, z, n)
-	vPrime.Mul(vPrime, aux).Mod(vPrime, n)
+	vPrime, err := meta.multiExpV(z, []*big.Int{vki}, []*big.Int{negC})
+	if err != nil {
+		return fmt.Errorf("invalid signature share with id %d: %v", sigShare.Id, err)
+	}
 
 	// x' = x~^z * x_i^(-2c)
-	aux.Mul(negC, big.NewInt(2))
-	xiNeg2c.Exp(xi, aux, n)
-
-	aux.Exp(xTilde, z, n)
-	xPrime.Mul(aux, xiNeg2c)
-	xPrime.Mod(xPrime, n)
-
-	// Hashing all the values
-	sha := sha256.New()
-	sha.Write(v.Bytes())
-	sha.Write(u.Bytes())
-	sha.Write(xTilde.Bytes())
-	sha.Write(vki.Bytes())
-	sha.Write(xi2.Bytes())
-	sha.Write(vPrime.Bytes())
-	sha.Write(xPrime.Bytes())
-
-	hash := sha.Sum(nil)
-
-	c2.SetBytes(hash)
-	c2.Mod(c2, n)
-
-	if c2.Cmp(c) == 0 {
-		return nil
+	negC2.Mul(negC, big.NewInt(2))
+	xPrime, err := multiExp([]*big.Int{xTilde, xi}, []*big.Int{z, negC2}, n)
+	if err != nil {
+		return fmt.Errorf("invalid signature share with id %d: %v", sigShare.Id, err)
+	}
+
+	// c2 = hash(transcript) % n
+	c2, err := meta.shareChallenge(sigShare.Version, sigShare.Id, context, &proofValues{
+		xTilde: xTilde,
+		vki:    vki,
+		xi2:    xi2,
+		vPrime: vPrime,
+		xPrime: xPrime,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid signature share with id %d: %v", sigShare.Id, err)
+	}
+
+	if c2.Cmp(c) != 0 {
+		return fmt.Errorf("invalid signature share with id %d", sigShare.Id)
+	}
+	// The commitments are not part of the proof, but a share should not carry ones that do not match it.
+	if (len(sigShare.V) != 0 && new(big.Int).SetBytes(sigShare.V).Cmp(vPrime) != 0) ||
+		(len(sigShare.X) != 0 && new(big.Int).SetBytes(sigShare.X).Cmp(xPrime) != 0) {
+		return fmt.Errorf("signature share with id %d has commitments that do not match its proof", sigShare.Id)
+	}
+	return nil
+}
+
+// checkBinding checks that the signature share was generated with the key of the key meta information and
+// for the document with the digest provided, if it records them, and in the epoch of the key.
+// It returns an error wrapping ErrKeyMismatch, ErrDocumentMismatch or ErrEpochMismatch if it was not.
+func (sigShare SigShare) checkBinding(meta *PreparedKeyMeta, docDigest []byte) error {
+	if len(sigShare.KeyID) != 0 && !sigShare.KeyID.Equal(meta.keyID) {
+		return fmt.Errorf("signature share with id %d: %w", sigShare.Id, ErrKeyMismatch)
+	}
+	if len(sigShare.DocDigest) != 0 && !bytes.Equal(sigShare.DocDigest, docDigest) {
+		return fmt.Errorf("signature share with id %d: %w", sigShare.Id, ErrDocumentMismatch)
+	}
+	if sigShare.Epoch != meta.Epoch {
+		return fmt.Errorf("signature share with id %d has epoch %d, but the key has epoch %d: %w", sigShare.Id, sigShare.Epoch, meta.Epoch, ErrEpochMismatch)
 	}
-	return fmt.Errorf("invalid signature share with id %d", sigShare.Id)
+	return nil
 }
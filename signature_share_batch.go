@@ -0,0 +1,338 @@
+package tcrsa
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Bit length of the random weights used to aggregate the shares of a batch.
+const batchWeightBitLen = 128
+
+// Domain separation tags for the hashes of a batch proof in the legacy format.
+const (
+	batchWeightTag    = "tcrsa/batch/weight"
+	batchChallengeTag = "tcrsa/batch/challenge"
+)
+
+// Domain separation tags for the hashes of a version 1 batch proof.
+const (
+	batchWeightTagV1 = "tcrsa/batch-weight/v1"
+	batchProofTag    = "tcrsa/batch-proof/v1"
+)
+
+// BatchSigShare represents the signature shares of a node for several documents, with a single
+// correctness proof for all of them.
+type BatchSigShare struct {
+	Xi [][]byte // Signature shares, one per document.
+	C  []byte   // Verification value.
+	Z  []byte   // Verification value
+	Id uint16   // ID of the node which generated the Signature Shares.
+
+	// Format version of the correctness proof (C and Z values). The ProofVersion1 format binds the proof to the
+	// public key, the id, the key identifier, the epoch and the documents of the batch. The batches generated by
+	// previous versions of the library have the ProofVersionLegacy format.
+	Version uint8
+
+	Name string // Name of the participant which generated the Signature Shares, if the key has participant names.
+
+	// Identifier of the key the shares were generated with. It is empty in the batches generated by previous
+	// versions of the library, and then it is not checked.
+	KeyID KeyID
+
+	Epoch uint32 // Generation of the key share which generated the Signature Shares.
+
+	// SHA-256 digests of the prepared documents the shares were generated for, in the same order. They are empty
+	// in the batches generated by previous versions of the library, and then they are not checked.
+	DocDigests [][]byte
+}
+
+// BatchSigShareList is a list of batch signature shares ready to be joined.
+type BatchSigShareList []*BatchSigShare
+
+// SigShares returns the signature shares of the batch as a list of SigShare values, bound to the key, the epoch
+// and the documents of the batch. They do not carry a correctness proof of their own, so they can be joined but
+// not verified one by one.
+func (batch BatchSigShare) SigShares() SigShareList {
+	sigShares := make(SigShareList, len(batch.Xi))
+	for j, xi := range batch.Xi {
+		sigShares[j] = &SigShare{
+			Xi:    xi,
+			Id:    batch.Id,
+			Name:  batch.Name,
+			KeyID: batch.KeyID,
+			Epoch: batch.Epoch,
+		}
+		if j < len(batch.DocDigests) {
+			sigShares[j].DocDigest = batch.DocDigests[j]
+		}
+	}
+	return sigShares
+}
+
+// Verify verifies that a batch of signature shares was generated for the documents provided, in the
+// same order, and using a key related to the key metadata provided.
+// It returns nil if the batch is valid, and an error if it is not.
+func (batch BatchSigShare) Verify(docs [][]byte, info MetaInfo) error {
+	if len(docs) != len(batch.Xi) {
+		return fmt.Errorf("batch with id %d has %d signature shares, but there are %d documents", batch.Id, len(batch.Xi), len(docs))
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("there are no documents to verify")
+	}
+
+	z := new(big.Int)
+	c := new(big.Int)
+
+	negC := new(big.Int)
+
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return err
+	}
+	if err := meta.checkProofVerification(); err != nil {
+		return err
+	}
+	if batch.Id, err = meta.participantId(batch.Name, batch.Id); err != nil {
+		return err
+	}
+	if err := batch.checkBinding(meta, docs); err != nil {
+		return err
+	}
+	n := meta.n
+	vki, err := meta.verificationKey(batch.Id)
+	if err != nil {
+		return err
+	}
+
+	z.SetBytes(batch.Z)
+	c.SetBytes(batch.C)
+
+	xTildes := make([]*big.Int, len(docs))
+	xi2s := make([]*big.Int, len(docs))
+
+	for j, doc := range docs {
+		x, _ := meta.adjustDocument(doc)
+		// x~ = x^4 % n
+		xTildes[j] = x.Exp(x, big.NewInt(4), n)
+		// xi_2 = xi^2 % n
+		xi := new(big.Int).SetBytes(batch.Xi[j])
+		xi2s[j] = xi.Exp(xi, big.NewInt(2), n)
+	}
+
+	docDigests := make([][]byte, len(docs))
+	for j, doc := range docs {
+		docDigests[j] = documentDigest(doc)
+	}
+	xTilde, xi2, err := meta.batchAggregate(batch.Version, vki, docDigests, xTildes, xi2s)
+	if err != nil {
+		return fmt.Errorf("invalid batch signature share with id %d: %v", batch.Id, err)
+	}
+
+	// v' = v^z * v_i^(-c)
+	negC.Neg(c)
+	vPrime, err := meta.multiExpV(z, []*big.Int{vki}, []*big.Int{negC})
+	if err != nil {
+		return fmt.Errorf("invalid batch signature share with id %d: %v", batch.Id, err)
+	}
+
+	// X' = X^z * Xi^(-c)
+	xPrime, err := multiExp([]*big.Int{xTilde, xi2}, []*big.Int{z, negC}, n)
+	if err != nil {
+		return fmt.Errorf("invalid batch signature share with id %d: %v", batch.Id, err)
+	}
+
+	c2, err := meta.batchChallenge(batch.Version, batch.Id, batch.Epoch, xTilde, vki, xi2, vPrime, xPrime)
+	if err != nil {
+		return fmt.Errorf("invalid batch signature share with id %d: %v", batch.Id, err)
+	}
+
+	if c2.Cmp(c) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid batch signature share with id %d", batch.Id)
+}
+
+// checkBinding checks that the batch was generated with the key of the key meta information and for the
+// documents provided, in the same order, if it records them, and in the epoch of the key.
+// It returns an error wrapping ErrKeyMismatch, ErrDocumentMismatch or ErrEpochMismatch if it was not.
+func (batch BatchSigShare) checkBinding(meta *PreparedKeyMeta, docs [][]byte) error {
+	if len(batch.DocDigests) != 0 && len(batch.DocDigests) != len(docs) {
+		return fmt.Errorf("batch with id %d has %d document digests, but there are %d documents: %w", batch.Id, len(batch.DocDigests), len(docs), ErrDocumentMismatch)
+	}
+	if err := (SigShare{Id: batch.Id, KeyID: batch.KeyID, Epoch: batch.Epoch}).checkBinding(meta, nil); err != nil {
+		return err
+	}
+	for j, docDigest := range batch.DocDigests {
+		if err := (SigShare{Id: batch.Id, DocDigest: docDigest, Epoch: batch.Epoch}).checkBinding(meta, documentDigest(docs[j])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Join generates the standard RSA signatures of the documents provided, in the same order, using the
+// batch signature shares of several nodes.
+// The number of batches should be at least the number of threshold defined at key creation, and if the key
+// has an access structure policy, their signers should satisfy it.
+// The values that only depend on the signers are computed once and reused for all the documents.
+// It returns the RSA signatures generated, or an error if the process fails.
+func (batchList BatchSigShareList) Join(docs [][]byte, info MetaInfo) (signatures []Signature, err error) {
+	if docs == nil {
+		err = fmt.Errorf("documents are nil")
+		return
+	}
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(batchList); i++ {
+		if batchList[i] == nil {
+			err = fmt.Errorf("batch signature share %d is nil", i)
+			return
+		}
+		if len(batchList[i].Xi) != len(docs) {
+			err = fmt.Errorf("batch with id %d has %d signature shares, but there are %d documents", batchList[i].Id, len(batchList[i].Xi), len(docs))
+			return
+		}
+		if err = batchList[i].checkBinding(meta, docs); err != nil {
+			return
+		}
+	}
+
+	k := meta.K
+	if len(batchList) < int(k) {
+		err = fmt.Errorf("insufficient number of batch signature shares. provided: %d, needed: %d", len(batchList), k)
+		return
+	}
+
+	available := make(SigShareList, len(batchList))
+	for i := range available {
+		available[i] = &SigShare{Id: batchList[i].Id, Name: batchList[i].Name}
+	}
+	if available, err = available.resolve(meta); err != nil {
+		return
+	}
+	ids := make([]uint16, len(available))
+	for i, signer := range available {
+		ids[i] = signer.Id
+	}
+	positions, err := meta.selectSigners(ids)
+	if err != nil {
+		return
+	}
+	signers := make(SigShareList, len(positions))
+	for i, position := range positions {
+		signers[i] = available[position]
+	}
+	c, err := signers.newCombiner(meta)
+	if err != nil {
+		return
+	}
+
+	signatures = make([]Signature, len(docs))
+	xis := make([]*big.Int, len(positions))
+	for i := range xis {
+		xis[i] = new(big.Int)
+	}
+	for j, doc := range docs {
+		if doc == nil {
+			err = fmt.Errorf("document %d is nil", j)
+			return
+		}
+		for i, position := range positions {
+			xis[i].SetBytes(batchList[position].Xi[j])
+		}
+		sig, err := c.join(doc, xis)
+		if err != nil {
+			return nil, err
+		}
+		// Pads sig with zeros until pk size
+		signatures[j] = make(Signature, meta.PublicKey.Size())
+		copy(signatures[j][len(signatures[j])-len(sig):], sig)
+	}
+	return
+}
+
+// batchAggregate computes X = prod(x~_j^a_j) and Xi = prod(xi2_j^a_j), where the weights a_j are
+// derived by hashing the verification values and all the documents and shares of the batch. In the ProofVersion1
+// format, the hash also covers the public key and the digests of the documents.
+// It returns an error if the version is unknown.
+func (meta *PreparedKeyMeta) batchAggregate(version uint8, vki *big.Int, docDigests [][]byte, xTildes, xi2s []*big.Int) (xTilde, xi2 *big.Int, err error) {
+	sha := sha256.New()
+	switch version {
+	case ProofVersionLegacy:
+		sha.Write([]byte(batchWeightTag))
+		writeLengthPrefixed(sha, meta.v.Bytes())
+		writeLengthPrefixed(sha, meta.u.Bytes())
+		writeLengthPrefixed(sha, vki.Bytes())
+		for j := range xTildes {
+			writeLengthPrefixed(sha, xTildes[j].Bytes())
+			writeLengthPrefixed(sha, xi2s[j].Bytes())
+		}
+	case ProofVersion1:
+		writeLengthPrefixed(sha, []byte(batchWeightTagV1))
+		for _, value := range []*big.Int{meta.n, meta.e, meta.v, meta.u, vki} {
+			writeLengthPrefixed(sha, value.Bytes())
+		}
+		for j := range xTildes {
+			writeLengthPrefixed(sha, docDigests[j])
+			writeLengthPrefixed(sha, xTildes[j].Bytes())
+			writeLengthPrefixed(sha, xi2s[j].Bytes())
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown proof version %d", version)
+	}
+	seed := sha.Sum(nil)
+
+	weights := make([]*big.Int, len(xTildes))
+	var counter [4]byte
+	for j := range weights {
+		binary.BigEndian.PutUint32(counter[:], uint32(j))
+		weight := sha256.Sum256(append(append([]byte{}, seed...), counter[:]...))
+		weights[j] = new(big.Int).SetBytes(weight[:batchWeightBitLen/8])
+	}
+	// The weights are positive, so multiExp never fails here.
+	xTilde, _ = multiExp(xTildes, weights, meta.n)
+	xi2, _ = multiExp(xi2s, weights, meta.n)
+	return xTilde, xi2, nil
+}
+
+// batchChallenge returns the challenge of a batch proof in the format of the version provided, computed with the
+// proof parameters of the key. The ProofVersion1 format hashes a domain-separated transcript with length-prefixed
+// values, as the version 1 share proofs, bound to the public key, the id, the key identifier and the epoch.
+// It returns an error if the version is unknown.
+func (meta *PreparedKeyMeta) batchChallenge(version uint8, id uint16, epoch uint32, xTilde, vki, xi2, vPrime, xPrime *big.Int) (*big.Int, error) {
+	h := meta.proof.Hash.New()
+	switch version {
+	case ProofVersionLegacy:
+		h.Write([]byte(batchChallengeTag))
+	case ProofVersion1:
+		var idBytes [2]byte
+		binary.BigEndian.PutUint16(idBytes[:], id)
+		var epochBytes [4]byte
+		binary.BigEndian.PutUint32(epochBytes[:], epoch)
+		writeLengthPrefixed(h, []byte(batchProofTag))
+		writeLengthPrefixed(h, meta.n.Bytes())
+		writeLengthPrefixed(h, meta.e.Bytes())
+		writeLengthPrefixed(h, idBytes[:])
+		writeLengthPrefixed(h, meta.keyID)
+		writeLengthPrefixed(h, epochBytes[:])
+	default:
+		return nil, fmt.Errorf("unknown proof version %d", version)
+	}
+	for _, value := range []*big.Int{meta.v, meta.u, xTilde, vki, xi2, vPrime, xPrime} {
+		writeLengthPrefixed(h, value.Bytes())
+	}
+	return meta.proof.challenge(h.Sum(nil)), nil
+}
+
+// writeLengthPrefixed writes b in w, preceded by its length as a 32 bit big endian integer.
+func writeLengthPrefixed(w io.Writer, b []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(b)))
+	w.Write(length[:])
+	w.Write(b)
+}
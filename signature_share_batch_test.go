@@ -0,0 +1,344 @@
+package tcrsa_test
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/niclabs/tcrsa"
+	"math/big"
+	"testing"
+)
+
+const batchTestDocs = 16
+const batchBenchmarkDocs = 64
+
+// fixedKeyArgs returns the key generation arguments defined by the fixed test values in key_test.go.
+func fixedKeyArgs(tb testing.TB) *tcrsa.KeyMetaArgs {
+	keyMetaArgs := &tcrsa.KeyMetaArgs{}
+	for _, v := range []struct {
+		dst **big.Int
+		b64 string
+	}{
+		{&keyMetaArgs.P, keyTestFixedP},
+		{&keyMetaArgs.Q, keyTestFixedQ},
+		{&keyMetaArgs.R, keyTestFixedR},
+		{&keyMetaArgs.U, keyTestFixedU},
+	} {
+		b, err := base64.StdEncoding.DecodeString(v.b64)
+		if err != nil {
+			tb.Fatalf("could not decode b64 value: %v", err)
+		}
+		*v.dst = new(big.Int).SetBytes(b)
+	}
+	return keyMetaArgs
+}
+
+// fixedKey creates the key defined by the fixed test values in key_test.go.
+func fixedKey(tb testing.TB) (tcrsa.KeyShareList, *tcrsa.KeyMeta) {
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, fixedKeyArgs(tb))
+	if err != nil {
+		tb.Fatalf("couldn't create keys: %v", err)
+	}
+	return keyShares, keyMeta
+}
+
+// batchDocs returns n documents prepared to be signed with keyMeta, with their hashes.
+func batchDocs(tb testing.TB, n int, keyMeta *tcrsa.KeyMeta) (docs [][]byte, hashes [][]byte) {
+	docs = make([][]byte, n)
+	hashes = make([][]byte, n)
+	for j := range docs {
+		docHash := sha256.Sum256([]byte(fmt.Sprintf("%s %d", keyTestMessage, j)))
+		docPKCS1, err := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), keyTestHashType, docHash[:])
+		if err != nil {
+			tb.Fatalf("%v", err)
+		}
+		docs[j] = docPKCS1
+		hashes[j] = docHash[:]
+	}
+	return
+}
+
+func TestSignBatch(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	docs, hashes := batchDocs(t, batchTestDocs, keyMeta)
+
+	batches := make(tcrsa.BatchSigShareList, len(keyShares))
+	for i, keyShare := range keyShares {
+		batch, err := keyShare.SignBatch(docs, keyTestHashType, keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := batch.Verify(docs, keyMeta); err != nil {
+			t.Errorf("%v", err)
+		}
+		batches[i] = batch
+	}
+
+	signatures, err := batches[1:].Join(docs, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for j, signature := range signatures {
+		if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, keyTestHashType, hashes[j], signature); err != nil {
+			t.Errorf("signature %d: %v", j, err)
+		}
+		sigShares := make(tcrsa.SigShareList, 0, keyMeta.K)
+		for _, batch := range batches[:keyMeta.K] {
+			sigShares = append(sigShares, batch.SigShares()[j])
+		}
+		single, err := sigShares.Join(docs[j], keyMeta)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, keyTestHashType, hashes[j], single); err != nil {
+			t.Errorf("signature %d joined from batch shares: %v", j, err)
+		}
+	}
+
+	// The batch proof must not be valid for other documents or a different order.
+	swapped := append([][]byte{}, docs...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	if err := batches[0].Verify(swapped, keyMeta); err == nil {
+		t.Errorf("batch should not be valid for documents in a different order")
+	}
+	tampered := *batches[0]
+	tampered.Xi = append([][]byte{}, tampered.Xi...)
+	tampered.Xi[batchTestDocs-1] = tampered.Xi[0]
+	if err := tampered.Verify(docs, keyMeta); err == nil {
+		t.Errorf("batch with a tampered share should not be valid")
+	}
+}
+
+func BenchmarkSign_loop(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	docs, _ := batchDocs(b, batchBenchmarkDocs, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			if _, err := keyShares[0].Sign(doc, keyTestHashType, keyMeta); err != nil {
+				b.Fatalf("%v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkSignBatch(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	docs, _ := batchDocs(b, batchBenchmarkDocs, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := keyShares[0].SignBatch(docs, keyTestHashType, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkVerify_loop(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	docs, _ := batchDocs(b, batchBenchmarkDocs, keyMeta)
+	sigShares := make(tcrsa.SigShareList, len(docs))
+	for j, doc := range docs {
+		var err error
+		if sigShares[j], err = keyShares[0].Sign(doc, keyTestHashType, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, doc := range docs {
+			if err := sigShares[j].Verify(doc, keyMeta); err != nil {
+				b.Fatalf("%v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkBatchVerify(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	docs, _ := batchDocs(b, batchBenchmarkDocs, keyMeta)
+	batch, err := keyShares[0].SignBatch(docs, keyTestHashType, keyMeta)
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := batch.Verify(docs, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkJoin_loop(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	docs, _ := batchDocs(b, batchBenchmarkDocs, keyMeta)
+	sigShares := make([]tcrsa.SigShareList, len(docs))
+	for j, doc := range docs {
+		sigShares[j] = make(tcrsa.SigShareList, keyMeta.K)
+		for i := range sigShares[j] {
+			var err error
+			if sigShares[j][i], err = keyShares[i].Sign(doc, keyTestHashType, keyMeta); err != nil {
+				b.Fatalf("%v", err)
+			}
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, doc := range docs {
+			if _, err := sigShares[j].Join(doc, keyMeta); err != nil {
+				b.Fatalf("%v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkBatchJoin(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	docs, _ := batchDocs(b, batchBenchmarkDocs, keyMeta)
+	batches := make(tcrsa.BatchSigShareList, keyMeta.K)
+	for i := range batches {
+		var err error
+		if batches[i], err = keyShares[i].SignBatch(docs, keyTestHashType, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := batches.Join(docs, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+// listSigShares signs a document with all the key shares.
+func listSigShares(b *testing.B, keyShares tcrsa.KeyShareList, keyMeta *tcrsa.KeyMeta) ([]byte, tcrsa.SigShareList) {
+	docs, _ := batchDocs(b, 1, keyMeta)
+	sigShares := make(tcrsa.SigShareList, len(keyShares))
+	for i, keyShare := range keyShares {
+		var err error
+		if sigShares[i], err = keyShare.Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+	return docs[0], sigShares
+}
+
+func BenchmarkSigShareList_VerifyParallel(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	doc, sigShares := listSigShares(b, keyShares, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sigShares.VerifyParallel(doc, keyMeta, 0); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkSigShareList_BatchVerify(b *testing.B) {
+	keyShares, keyMeta := fixedKey(b)
+	doc, sigShares := listSigShares(b, keyShares, keyMeta)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sigShares.BatchVerify(doc, keyMeta); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func TestSignBatch_epoch(t *testing.T) {
+	args := fixedKeyArgs(t)
+	args.Epoch = 7
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	docs, _ := batchDocs(t, 2, keyMeta)
+	batches := make(tcrsa.BatchSigShareList, keyMeta.K)
+	for i := range batches {
+		if batches[i], err = keyShares[i].SignBatch(docs, keyTestHashType, keyMeta); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if batches[i].Epoch != 7 || len(batches[i].KeyID) == 0 {
+			t.Errorf("batch should have the key id and epoch 7, but it has epoch %d", batches[i].Epoch)
+		}
+	}
+	if _, err := batches.Join(docs, keyMeta); err != nil {
+		t.Fatalf("%v", err)
+	}
+	// The signature shares of the batches keep their binding, so they are joined with the key of epoch 7.
+	for j := range docs {
+		sigShares := make(tcrsa.SigShareList, len(batches))
+		for i, batch := range batches {
+			sigShares[i] = batch.SigShares()[j]
+		}
+		if _, err := sigShares.Join(docs[j], keyMeta); err != nil {
+			t.Errorf("%v", err)
+		}
+		if _, err := sigShares.Join(docs[1-j], keyMeta); !errors.Is(err, tcrsa.ErrDocumentMismatch) {
+			t.Errorf("join error should be %v, but it is %v", tcrsa.ErrDocumentMismatch, err)
+		}
+	}
+	swapped := [][]byte{docs[1], docs[0]}
+	if _, err := batches.Join(swapped, keyMeta); !errors.Is(err, tcrsa.ErrDocumentMismatch) {
+		t.Errorf("join error should be %v, but it is %v", tcrsa.ErrDocumentMismatch, err)
+	}
+
+	// The key meta information of the next epoch rejects the batches of epoch 7.
+	nextMeta := *keyMeta
+	nextMeta.Epoch = 8
+	if err := batches[0].Verify(docs, &nextMeta); !errors.Is(err, tcrsa.ErrEpochMismatch) {
+		t.Errorf("verification error should be %v, but it is %v", tcrsa.ErrEpochMismatch, err)
+	}
+	if _, err := batches.Join(docs, &nextMeta); !errors.Is(err, tcrsa.ErrEpochMismatch) {
+		t.Errorf("join error should be %v, but it is %v", tcrsa.ErrEpochMismatch, err)
+	}
+
+	// A batch of a previous epoch without a key id is only detected by its epoch.
+	mixed := *batches[0]
+	mixed.KeyID = nil
+	mixed.Epoch = 6
+	if err := mixed.Verify(docs, keyMeta); !errors.Is(err, tcrsa.ErrEpochMismatch) {
+		t.Errorf("verification error should be %v, but it is %v", tcrsa.ErrEpochMismatch, err)
+	}
+	if _, err := append(tcrsa.BatchSigShareList{&mixed}, batches[1:]...).Join(docs, keyMeta); !errors.Is(err, tcrsa.ErrEpochMismatch) {
+		t.Errorf("join error should be %v, but it is %v", tcrsa.ErrEpochMismatch, err)
+	}
+	_, otherMeta := fixedKey(t)
+	otherMeta.Epoch = 7
+	if _, err := batches.Join(docs, otherMeta); !errors.Is(err, tcrsa.ErrKeyMismatch) {
+		t.Errorf("join error should be %v, but it is %v", tcrsa.ErrKeyMismatch, err)
+	}
+}
+
+func TestSignBatch_proofBinding(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	docs, _ := batchDocs(t, 2, keyMeta)
+	batch, err := keyShares[0].SignBatch(docs, keyTestHashType, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if batch.Version != tcrsa.ProofVersion1 {
+		t.Errorf("batch proof version should be %d, but it is %d", tcrsa.ProofVersion1, batch.Version)
+	}
+	if err := batch.Verify(docs, keyMeta); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, version := range []uint8{tcrsa.ProofVersionLegacy, 9} {
+		other := *batch
+		other.Version = version
+		if err := other.Verify(docs, keyMeta); err == nil {
+			t.Errorf("batch proof should not verify with version %d", version)
+		}
+	}
+
+	// Without the recorded bindings, the proof is still bound to the epoch of the batch.
+	other := *batch
+	other.KeyID, other.DocDigests = nil, nil
+	other.Epoch = 1
+	nextMeta := *keyMeta
+	nextMeta.Epoch = 1
+	if err := other.Verify(docs, &nextMeta); err == nil {
+		t.Errorf("batch proof should be bound to its epoch")
+	}
+}
@@ -3,134 +3,353 @@ package tcrsa
 import (
 	"fmt"
 	"math/big"
+	"runtime"
+	"sync"
 )
 
 // SigShareList is a list of sigShares ready to be joined.
 type SigShareList []*SigShare
 
 // Join generates a standard RSA signature using the signature shares of the document provided.
-// The number of signatures should be at least the number of threshold defined at key creation.
+// The number of signatures should be at least the number of threshold defined at key creation. A
+// participant with weight w contributes w signature shares, so it counts as w signers. If the key has an
+// access structure policy, the signers should satisfy it, and a minimal subset of them that satisfies it is used.
 // It returns the RSA signature generated, or an error if the process fails.
-func (sigShareList SigShareList) Join(document []byte, info *KeyMeta) (signature Signature, err error) {
-	signature = make([]byte, info.PublicKey.Size())
+func (sigShareList SigShareList) Join(document []byte, info MetaInfo) (signature Signature, err error) {
 	if document == nil {
 		err = fmt.Errorf("document is nil")
 		return
 	}
-	if info == nil {
-		err = fmt.Errorf("key metainfo is nil")
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
 		return
 	}
+	signature = make([]byte, meta.PublicKey.Size())
 
-	if len(sigShareList) < int(info.K) {
-
-	}
-
-	for i := 0; i < len(sigShareList); i++ {
-		if sigShareList[i] == nil {
-			err = fmt.Errorf("signature share %d is nil", i)
-			return
-		}
+	if sigShareList, err = sigShareList.resolve(meta); err != nil {
+		return
 	}
 
-	k := info.K
+	k := meta.K
 	if len(sigShareList) < int(k) {
 		err = fmt.Errorf("insufficient number of signature shares. provided: %d, needed: %d", len(sigShareList), k)
 		return
 	}
+	signers, err := sigShareList.selectSigners(meta)
+	if err != nil {
+		return
+	}
+	if err = signers.checkBindings(document, meta); err != nil {
+		return
+	}
 
-	x := new(big.Int)
-	n := new(big.Int)
-	e := new(big.Int)
-	u := new(big.Int)
-	delta := new(big.Int)
-	ePrime := new(big.Int)
-	w := new(big.Int)
-	si := new(big.Int)
-	aux := new(big.Int)
-	a := new(big.Int)
-	b := new(big.Int)
-	wa := new(big.Int)
-	xb := new(big.Int)
-	y := new(big.Int)
-	lambdaK2 := new(big.Int)
-
-	x.SetBytes(document)
-	n.Set(info.PublicKey.N)
-	e.SetUint64(uint64(info.PublicKey.E))
-	u.SetBytes(info.VerificationKey.U)
+	c, err := signers.newCombiner(meta)
+	if err != nil {
+		return
+	}
+	xis := make([]*big.Int, len(signers))
+	for i := range xis {
+		xis[i] = new(big.Int).SetBytes(signers[i].Xi)
+	}
+	sig, err := c.join(document, xis)
+	if err != nil {
+		return
+	}
+	// Pads sig with zeros until pk size
+	copy(signature[len(signature)-len(sig):], sig)
+	return
+}
 
-	// x = doc if (doc | n) == 1 else doc * u^e
+// combiner stores the values needed to join signature shares that only depend on the key and the
+// set of signers, so they can be reused when joining several documents signed by the same signers.
+type combiner struct {
+	meta     *PreparedKeyMeta
+	tA       *big.Int   // Exponent of the product of the shares.
+	b        *big.Int   // Exponent of the document.
+	lambdas2 []*big.Int // Exponents of the shares, in the same order as the signers.
+}
 
-	jacobied := false
+// selectSigners returns the signature shares of the list that join a signature, as chosen by the
+// selectSigners method of the key meta information.
+func (sigShareList SigShareList) selectSigners(meta *PreparedKeyMeta) (SigShareList, error) {
+	ids := make([]uint16, len(sigShareList))
+	for i, sigShare := range sigShareList {
+		ids[i] = sigShare.Id
+	}
+	positions, err := meta.selectSigners(ids)
+	if err != nil {
+		return nil, err
+	}
+	signers := make(SigShareList, len(positions))
+	for i, position := range positions {
+		signers[i] = sigShareList[position]
+	}
+	return signers, nil
+}
 
-	if big.Jacobi(x, n) == -1 {
-		ue := new(big.Int).Exp(u, e, n)
-		x.Mul(x, ue).Mod(x, n)
-		jacobied = true
-	} else {
+// newCombiner prepares a combiner for the signers in the list, which should have exactly k elements, or be
+// a minimal set that satisfies the policy of the key.
+func (sigShareList SigShareList) newCombiner(meta *PreparedKeyMeta) (*combiner, error) {
+	ids := make([]uint16, len(sigShareList))
+	for i, sigShare := range sigShareList {
+		ids[i] = sigShare.Id
+	}
+	coefficients, err := meta.joinCoefficients(ids)
+	if err != nil {
+		return nil, err
 	}
+	c := &combiner{
+		meta:     meta,
+		tA:       coefficients.tA,
+		b:        coefficients.b,
+		lambdas2: make([]*big.Int, len(ids)),
+	}
+	for i, id := range ids {
+		c.lambdas2[i] = coefficients.lambdas2[id]
+	}
+	return c, nil
+}
 
-	delta.MulRange(1, int64(info.L))
-	ePrime.SetInt64(4)
+// join generates the RSA signature of a document using the xi values of the signers of the combiner,
+// in the same order. It returns the signature without padding.
+func (c *combiner) join(document []byte, xis []*big.Int) ([]byte, error) {
+	n := c.meta.n
 
-	// Calculate w
-	w.SetInt64(1)
+	// x = doc if (doc | n) == 1 else doc * u^e
+	x, jacobied := c.meta.adjustDocument(document)
 
-	var i uint16
-	for i = 0; i < k; i++ {
-		si.SetBytes(sigShareList[i].Xi)
-		id := int64(sigShareList[i].Id)
-		lambdaK2, err = sigShareList.lagrangeInterpolation(id, int64(k), delta)
-		if err != nil {
-			return
-		}
-		lambdaK2.Mul(lambdaK2, big.NewInt(2))
-		aux.Exp(si, lambdaK2, n)
-		w.Mul(w, aux)
+	// w = prod(xi^(2*d*lambda_i))
+	w, err := multiExp(xis, c.lambdas2, n)
+	if err != nil {
+		return nil, err
 	}
 
-	w.Mod(w, n)
-
-	aux.GCD(a, b, ePrime, e)
-	wa.Exp(w, a, n)
-	xb.Exp(x, b, n)
-	y.Mul(wa, xb)
+	// y = w^((delta/d)*a) * x^b
+	y, err := multiExp([]*big.Int{w, x}, []*big.Int{c.tA, c.b}, n)
+	if err != nil {
+		return nil, err
+	}
 
 	if jacobied {
-		invU := new(big.Int).ModInverse(u, n)
-		y.Mul(y, invU)
+		y.Mul(y, c.meta.invU)
 	}
 
 	y.Mod(y, n)
-	sig := y.Bytes()
-	// Pads sig with zeros until pk size
-	copy(signature[len(signature)-len(sig):], sig)
+	return y.Bytes(), nil
+}
+
+// VerifyParallel verifies all the signature shares of the list for the document provided, running
+// the verifications concurrently on at most workers goroutines. If workers is not positive, the number
+// of CPUs is used.
+// It returns the ids of the invalid signature shares, and an error if any of them is invalid.
+func (sigShareList SigShareList) VerifyParallel(doc []byte, info MetaInfo, workers int) (invalid []uint16, err error) {
+	sigShareList, meta, err := sigShareList.checkVerifiable(doc, info)
+	if err != nil {
+		return
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(sigShareList) {
+		workers = len(sigShareList)
+	}
+
+	results := make([]error, len(sigShareList))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = sigShareList[i].Verify(doc, meta)
+			}
+		}()
+	}
+	for i := range sigShareList {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, result := range results {
+		if result != nil {
+			invalid = append(invalid, sigShareList[i].Id)
+		}
+	}
+	if len(invalid) > 0 {
+		err = fmt.Errorf("invalid signature shares with ids %v", invalid)
+	}
 	return
 }
 
-// This function generates the lagrange interpolation for a set of signature shares.
-func (sigShareList SigShareList) lagrangeInterpolation(j, k int64, delta *big.Int) (*big.Int, error) {
+// BatchVerify checks at once that all the signature shares of the list are valid for the document provided.
+// Instead of checking the proof of every share on its own, it checks the challenges of the proofs against their
+// commitments and then all the proof equations together, raised to random small exponents, so it needs two
+// multi-exponentiations for the whole list instead of four exponentiations per share. If the batch check fails,
+// it falls back to VerifyParallel to identify the invalid shares. The shares without commitments, generated by
+// previous versions of the library, are verified with VerifyParallel.
+// It returns the ids of the invalid signature shares, and an error if any of them is invalid.
+func (sigShareList SigShareList) BatchVerify(doc []byte, info MetaInfo) (invalid []uint16, err error) {
+	sigShareList, meta, err := sigShareList.checkVerifiable(doc, info)
+	if err != nil {
+		return
+	}
+	// The shares generated with other keys or for other documents are reported by VerifyParallel.
+	if sigShareList.checkBindings(doc, meta) != nil {
+		return sigShareList.VerifyParallel(doc, meta, 0)
+	}
+	var batched, single SigShareList
+	for _, sigShare := range sigShareList {
+		if len(sigShare.V) == 0 || len(sigShare.X) == 0 {
+			single = append(single, sigShare)
+		} else {
+			batched = append(batched, sigShare)
+		}
+	}
+	if len(batched) != 0 {
+		ok, err := batched.batchCheck(doc, meta)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			invalid, err = sigShareList.VerifyParallel(doc, meta, 0)
+			if err == nil {
+				err = fmt.Errorf("batch check of the signature shares failed, but all their proofs are valid")
+			}
+			return invalid, err
+		}
+	}
+	if len(single) == 0 {
+		return
+	}
+	return single.VerifyParallel(doc, meta, 0)
+}
+
+// checkBindings checks that all the signature shares of the list were generated with the key of the key
+// meta information and for the document provided, if they record them, and in the epoch of the key.
+// It returns an error wrapping ErrKeyMismatch, ErrDocumentMismatch or ErrEpochMismatch for the first share
+// that was not.
+func (sigShareList SigShareList) checkBindings(doc []byte, meta *PreparedKeyMeta) error {
+	docDigest := documentDigest(doc)
+	for _, sigShare := range sigShareList {
+		if err := sigShare.checkBinding(meta, docDigest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if int64(len(sigShareList)) < k {
-		return new(big.Int), fmt.Errorf("signature shares are not enough. provided=%d, needed=%d", len(sigShareList), k)
+// checkVerifiable checks that the list can be verified: the shares are not nil, their participants are
+// known and their ids are valid and not repeated. It returns the list with the ids of the shares addressed
+// by name resolved, and the prepared key meta information.
+func (sigShareList SigShareList) checkVerifiable(doc []byte, info MetaInfo) (SigShareList, *PreparedKeyMeta, error) {
+	if doc == nil {
+		return nil, nil, fmt.Errorf("document is nil")
+	}
+	meta, err := prepareMetaInfo(info)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := meta.checkProofVerification(); err != nil {
+		return nil, nil, err
+	}
+	if len(sigShareList) == 0 {
+		return nil, nil, fmt.Errorf("there are no signature shares to verify")
+	}
+	resolved, err := sigShareList.resolve(meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make(map[uint16]bool, len(resolved))
+	for i, sigShare := range resolved {
+		if sigShare.Id < 1 || sigShare.Id > meta.L {
+			return nil, nil, fmt.Errorf("signature share %d has id %d, but it should be between 1 and %d", i, sigShare.Id, meta.L)
+		}
+		if ids[sigShare.Id] {
+			return nil, nil, fmt.Errorf("there is more than one signature share with id %d", sigShare.Id)
+		}
+		ids[sigShare.Id] = true
 	}
-	out := new(big.Int)
+	return resolved, meta, nil
+}
+
+// batchCheck runs the randomized batch check of BatchVerify. All the shares of the list should have the
+// commitments v'_i and x'_i of their proofs. The proof of a share is valid if its challenge c_i is the hash of
+// its commitments, and v^z_i * vk_i^(-c_i) = v'_i and x~^z_i * xi_i^(-2*c_i) = x'_i. The challenges are checked
+// one by one, and the equations of all the shares at once, raising them to random small exponents t_i:
+//
+//	v^sum(t_i*z_i) * prod(vk_i^(-t_i*c_i)) = prod(v'_i^t_i)
+//	x~^sum(t_i*z_i) * prod(xi_i^(-2*t_i*c_i)) = prod(x'_i^t_i)
+//
+// The exponents t_i are even, so the equations are checked in the subgroup of squares, which has no small
+// subgroups for the safe primes of the key, and a commitment multiplied by an element of order two does not
+// pass the check half of the times.
+// It returns true if all the proofs are valid.
+func (sigShareList SigShareList) batchCheck(doc []byte, meta *PreparedKeyMeta) (bool, error) {
+	n := meta.n
+	x, _ := meta.adjustDocument(doc)
+	// x~ = x^4 % n
+	xTilde := x.Exp(x, big.NewInt(4), n)
 
-	out.Set(delta)
-	num := big.NewInt(1)
-	den := big.NewInt(1)
+	zSum := new(big.Int)
+	vkis := make([]*big.Int, len(sigShareList))
+	vkExps := make([]*big.Int, len(sigShareList))
+	xBases := []*big.Int{xTilde}
+	xExps := []*big.Int{zSum}
+	vPrimes := make([]*big.Int, len(sigShareList))
+	xPrimes := make([]*big.Int, len(sigShareList))
+	weights := make([]*big.Int, len(sigShareList))
+	for i, sigShare := range sigShareList {
+		xi := new(big.Int).SetBytes(sigShare.Xi)
+		vPrimes[i] = new(big.Int).SetBytes(sigShare.V)
+		xPrimes[i] = new(big.Int).SetBytes(sigShare.X)
+		for _, value := range []*big.Int{xi, vPrimes[i], xPrimes[i]} {
+			if value.Sign() == 0 || value.Cmp(n) >= 0 {
+				return false, nil
+			}
+		}
+		vki, err := meta.verificationKey(sigShare.Id)
+		if err != nil {
+			return false, err
+		}
+		c := new(big.Int).SetBytes(sigShare.C)
+		c2, err := meta.shareChallenge(sigShare.Version, sigShare.Id, nil, &proofValues{
+			xTilde: xTilde,
+			vki:    vki,
+			xi2:    new(big.Int).Exp(xi, big.NewInt(2), n),
+			vPrime: vPrimes[i],
+			xPrime: xPrimes[i],
+		})
+		if err != nil || c2.Cmp(c) != 0 {
+			return false, nil
+		}
 
-	var i int64
-	for i = 0; i < k; i++ {
-		id := int64(sigShareList[i].Id)
-		if id != j {
-			num.Mul(num, big.NewInt(id))   // num <-- num*j_
-			den.Mul(den, big.NewInt(id-j)) // den <-- den*(j_-j)
+		t, err := randInt(batchWeightBitLen / 2)
+		if err != nil {
+			return false, err
 		}
+		t.Lsh(t, 1)
+		weights[i] = t
+		zSum.Add(zSum, new(big.Int).Mul(t, new(big.Int).SetBytes(sigShare.Z)))
+		// -t_i*c_i
+		negTC := c.Mul(c, t).Neg(c)
+		vkis[i] = vki
+		vkExps[i] = negTC
+		xBases = append(xBases, xi)
+		xExps = append(xExps, new(big.Int).Lsh(negTC, 1))
 	}
-	out.Mul(out, num)
-	out.Div(out, den)
 
-	return out, nil
+	vLeft, err := meta.multiExpV(zSum, vkis, vkExps)
+	if err != nil {
+		return false, nil
+	}
+	xLeft, err := multiExp(xBases, xExps, n)
+	if err != nil {
+		return false, nil
+	}
+	// The weights are positive, so multiExp never fails here.
+	vRight, _ := multiExp(vPrimes, weights, n)
+	xRight, _ := multiExp(xPrimes, weights, n)
+	return vLeft.Cmp(vRight) == 0 && xLeft.Cmp(xRight) == 0, nil
 }
@@ -1,44 +1,134 @@
 package tcrsa
 
 import (
+	"crypto"
+	"crypto/sha256"
 	"math/big"
 	"testing"
 )
 
-func TestSignatureShareList_LagrangeInterpolation(t *testing.T) {
-	const signatureShareTestLength = 5
-	const signatureShareTestK = 5
-	const signatureShareTestM = 1024
+func TestSignatureShareList_BatchVerify(t *testing.T) {
+	const batchVerifyTestK = 3
+	const batchVerifyTestL = 5
+	const batchVerifyTestSize = 512
 
-	delta := new(big.Int)
-
-	shares := make(SigShareList, signatureShareTestLength)
-
-	var i uint16
-	for i = 0; i < signatureShareTestLength; i++ {
-		shares[i] = &SigShare{
-			Id: i + 1,
+	keyShares, keyMeta, err := NewKey(batchVerifyTestSize, batchVerifyTestK, batchVerifyTestL, nil)
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	docHash := sha256.Sum256([]byte("Hello world"))
+	doc, err := PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, docHash[:])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	shares := make(SigShareList, batchVerifyTestL)
+	for i := range shares {
+		shares[i], err = keyShares[i].Sign(doc, crypto.SHA256, keyMeta)
+		if err != nil {
+			t.Fatalf("%v", err)
 		}
 	}
-	delta.MulRange(1, signatureShareTestK)
 
-	results := []*big.Int{
-		big.NewInt(600),
-		big.NewInt(-1200),
-		big.NewInt(1200),
-		big.NewInt(-600),
-		big.NewInt(120),
+	if invalid, err := shares.BatchVerify(doc, keyMeta); err != nil || len(invalid) != 0 {
+		t.Errorf("valid shares should pass the batch check: %v", err)
+	}
+	if invalid, err := shares.VerifyParallel(doc, keyMeta, 2); err != nil || len(invalid) != 0 {
+		t.Errorf("valid shares should pass the parallel verification: %v", err)
 	}
 
-	for i := 0; i < signatureShareTestK; i++ {
-		res, err := shares.lagrangeInterpolation(int64(i+1), signatureShareTestK, delta)
-		if err != nil {
-			t.Errorf("couldn't compute lagrange interpolation")
-			return
+	// Corrupt the share of node 4, keeping its key and document binding, so only the batch check can reject it.
+	meta, err := keyMeta.prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	xi := new(big.Int).SetBytes(shares[3].Xi)
+	shares[3].Xi = xi.Mul(xi, big.NewInt(2)).Mod(xi, meta.n).Bytes()
+	if err := shares.checkBindings(doc, meta); err != nil {
+		t.Fatalf("corrupted share should keep its binding: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if ok, err := shares.batchCheck(doc, meta); err != nil || ok {
+			t.Fatalf("batch check should fail with an invalid share")
+		}
+		invalid, err := shares.BatchVerify(doc, keyMeta)
+		if err == nil {
+			t.Fatalf("batch verification should fail with an invalid share")
+		}
+		if len(invalid) != 1 || invalid[0] != 4 {
+			t.Errorf("invalid shares should be [4], but they are %v", invalid)
 		}
-		if res.Cmp(results[i]) != 0 {
-			t.Errorf("lagrange interpolation for i=%d failed. It is %s but it should be %s", i+1, res, results[i])
+	}
+	shares[4] = shares[3]
+	if _, err := shares.BatchVerify(doc, keyMeta); err == nil {
+		t.Errorf("batch check should fail with repeated ids")
+	}
+}
+
+// TestSignatureShareList_BatchVerify_collusion checks that the batch check verifies the proofs of the shares, and
+// not only that they join a valid signature: shares 2 to 5 are offset by x^(2*g(i)), with g(i) = i*(i-1), so
+// every subset of 3 shares still joins the signature, but their proofs are invalid.
+func TestSignatureShareList_BatchVerify_collusion(t *testing.T) {
+	keyShares, keyMeta, err := NewKey(512, 3, 5, nil)
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	meta, err := keyMeta.prepare()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	docHash := sha256.Sum256([]byte("Hello world"))
+	doc, err := PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, docHash[:])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	x, _ := meta.adjustDocument(doc)
+	shares := make(SigShareList, len(keyShares))
+	for i, keyShare := range keyShares {
+		if shares[i], err = keyShare.Sign(doc, crypto.SHA256, keyMeta); err != nil {
+			t.Fatalf("%v", err)
 		}
+		id := int64(keyShare.Id)
+		offset := new(big.Int).Exp(x, big.NewInt(2*id*(id-1)), meta.n)
+		xi := new(big.Int).SetBytes(shares[i].Xi)
+		shares[i].Xi = xi.Mul(xi, offset).Mod(xi, meta.n).Bytes()
+	}
+	if _, err := shares[1:4].Join(doc, keyMeta); err != nil {
+		t.Fatalf("offset shares should join a signature: %v", err)
+	}
+	if ok, err := shares.batchCheck(doc, meta); err != nil || ok {
+		t.Errorf("batch check should fail with offset shares")
+	}
+	invalid, err := shares.BatchVerify(doc, keyMeta)
+	if err == nil || len(invalid) != 4 || invalid[0] != 2 || invalid[3] != 5 {
+		t.Errorf("invalid shares should be [2 3 4 5], but they are %v", invalid)
 	}
+}
 
+// TestSignatureShareList_BatchVerify_commitments checks that the shares without commitments are verified on their
+// own, and that the shares with commitments that do not match their proofs are invalid.
+func TestSignatureShareList_BatchVerify_commitments(t *testing.T) {
+	keyShares, keyMeta, err := NewKey(512, 2, 3, nil)
+	if err != nil {
+		t.Fatalf("couldn't create keys: %v", err)
+	}
+	docHash := sha256.Sum256([]byte("Hello world"))
+	doc, err := PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, docHash[:])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	shares, err := keyShares.Sign(doc, crypto.SHA256, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	shares[0].V, shares[0].X = nil, nil
+	if invalid, err := shares.BatchVerify(doc, keyMeta); err != nil || len(invalid) != 0 {
+		t.Errorf("shares without commitments should be valid: %v", err)
+	}
+	shares[1].V, shares[1].X = shares[2].V, shares[2].X
+	if err := shares[1].Verify(doc, keyMeta); err == nil {
+		t.Errorf("share with the commitments of another share should be invalid")
+	}
+	if invalid, err := shares.BatchVerify(doc, keyMeta); err == nil || len(invalid) != 1 || invalid[0] != 2 {
+		t.Errorf("invalid shares should be [2], but they are %v", invalid)
+	}
 }
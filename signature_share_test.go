@@ -0,0 +1,113 @@
+package tcrsa_test
+
+import (
+	"errors"
+	"github.com/niclabs/tcrsa"
+	"math/big"
+	"testing"
+)
+
+func TestSigShare_binding(t *testing.T) {
+	keyShares, keyMeta := fixedKey(t)
+	docs, _ := batchDocs(t, 2, keyMeta)
+	sigShares := make(tcrsa.SigShareList, keyMeta.K)
+	for i := range sigShares {
+		var err error
+		if sigShares[i], err = keyShares[i].Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	// Another dealing of the same RSA key has a different identifier.
+	args := fixedKeyArgs(t)
+	args.R = new(big.Int).Add(args.R, big.NewInt(1))
+	otherShares, otherMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	otherKey, err := otherShares[keyMeta.K].Sign(docs[0], keyTestHashType, otherMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	otherDoc, err := keyShares[keyMeta.K].Sign(docs[1], keyTestHashType, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		sigShare *tcrsa.SigShare
+		err      error
+	}{
+		{"other key", otherKey, tcrsa.ErrKeyMismatch},
+		{"other document", otherDoc, tcrsa.ErrDocumentMismatch},
+	} {
+		if err := c.sigShare.Verify(docs[0], keyMeta); !errors.Is(err, c.err) {
+			t.Errorf("%s: verification error should be %v, but it is %v", c.name, c.err, err)
+		}
+		mixed := append(tcrsa.SigShareList{c.sigShare}, sigShares[1:]...)
+		if _, err := mixed.Join(docs[0], keyMeta); !errors.Is(err, c.err) {
+			t.Errorf("%s: join error should be %v, but it is %v", c.name, c.err, err)
+		}
+		invalid, err := append(mixed, sigShares[0]).BatchVerify(docs[0], keyMeta)
+		if err == nil || len(invalid) != 1 || invalid[0] != c.sigShare.Id {
+			t.Errorf("%s: batch verification should report share %d, but it reports %v", c.name, c.sigShare.Id, invalid)
+		}
+	}
+
+	// Shares without bindings are accepted.
+	legacy := make(tcrsa.SigShareList, len(sigShares))
+	for i, sigShare := range sigShares {
+		unbound := *sigShare
+		unbound.KeyID, unbound.DocDigest = nil, nil
+		legacy[i] = &unbound
+		if err := unbound.Verify(docs[0], keyMeta); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+	if _, err := legacy.Join(docs[0], keyMeta); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestSigShare_epoch(t *testing.T) {
+	args := fixedKeyArgs(t)
+	args.Epoch = 2
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if keyMeta.Epoch != 2 || keyShares[0].Epoch != 2 {
+		t.Errorf("key meta and key shares should have epoch 2, but they have %d and %d", keyMeta.Epoch, keyShares[0].Epoch)
+	}
+	docs, _ := batchDocs(t, 1, keyMeta)
+	sigShares := make(tcrsa.SigShareList, keyMeta.K)
+	for i := range sigShares {
+		if sigShares[i], err = keyShares[i].Sign(docs[0], keyTestHashType, keyMeta); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if sigShares[i].Epoch != 2 {
+			t.Errorf("signature share should have epoch 2, but it has %d", sigShares[i].Epoch)
+		}
+	}
+
+	// A share of a previous epoch without a key id is only detected by its epoch.
+	oldShare := *keyShares[0]
+	oldShare.KeyID = nil
+	oldShare.Epoch = 1
+	if _, err := oldShare.Sign(docs[0], keyTestHashType, keyMeta); !errors.Is(err, tcrsa.ErrEpochMismatch) {
+		t.Errorf("signing with a share of other epoch should fail with %v, but it fails with %v", tcrsa.ErrEpochMismatch, err)
+	}
+	mixed := *sigShares[0]
+	mixed.KeyID = nil
+	mixed.Epoch = 1
+	if err := mixed.Verify(docs[0], keyMeta); !errors.Is(err, tcrsa.ErrEpochMismatch) {
+		t.Errorf("verification error should be %v, but it is %v", tcrsa.ErrEpochMismatch, err)
+	}
+	if _, err := append(tcrsa.SigShareList{&mixed}, sigShares[1:]...).Join(docs[0], keyMeta); !errors.Is(err, tcrsa.ErrEpochMismatch) {
+		t.Errorf("join error should be %v, but it is %v", tcrsa.ErrEpochMismatch, err)
+	}
+	if _, err := sigShares.Join(docs[0], keyMeta); err != nil {
+		t.Errorf("%v", err)
+	}
+}
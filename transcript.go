@@ -0,0 +1,68 @@
+package tcrsa
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// Versions of the correctness proof of a signature share.
+const (
+	// ProofVersionLegacy is the original proof format, whose challenge hashes the concatenated values of the
+	// proof without binding them to the key, the share Id or a context. It is only accepted by Verify, so the
+	// shares of previous versions of the library can still be verified.
+	ProofVersionLegacy uint8 = 0
+	// ProofVersion1 is the proof format whose challenge is computed over a domain-separated transcript
+	// with length-prefixed values, bound to the public key, the share Id and an optional context.
+	ProofVersion1 uint8 = 1
+)
+
+// Domain separation tag of the transcript of a version 1 share proof.
+const shareProofTag = "tcrsa/share-proof/v1"
+
+// proofValues are the values hashed to compute the challenge of a signature share proof.
+type proofValues struct {
+	xTilde *big.Int // x^4
+	vki    *big.Int // Verification value of the share.
+	xi2    *big.Int // xi^2
+	vPrime *big.Int // v^r
+	xPrime *big.Int // x~^r
+}
+
+// shareChallenge returns the challenge of a signature share proof in the format of the version provided.
+// The legacy format always uses SHA-256 reduced modulo n and does not support a context, so it returns an
+// error if one is provided. The version 1 format uses the proof parameters of the key.
+func (meta *PreparedKeyMeta) shareChallenge(version uint8, id uint16, context []byte, values *proofValues) (*big.Int, error) {
+	switch version {
+	case ProofVersionLegacy:
+		if len(context) != 0 {
+			return nil, fmt.Errorf("proof version %d does not support a context", version)
+		}
+		sha := sha256.New()
+		sha.Write(meta.v.Bytes())
+		sha.Write(meta.u.Bytes())
+		sha.Write(values.xTilde.Bytes())
+		sha.Write(values.vki.Bytes())
+		sha.Write(values.xi2.Bytes())
+		sha.Write(values.vPrime.Bytes())
+		sha.Write(values.xPrime.Bytes())
+		c := new(big.Int).SetBytes(sha.Sum(nil))
+		return c.Mod(c, meta.n), nil
+	case ProofVersion1:
+		var idBytes [2]byte
+		binary.BigEndian.PutUint16(idBytes[:], id)
+		h := meta.proof.Hash.New()
+		writeLengthPrefixed(h, []byte(shareProofTag))
+		writeLengthPrefixed(h, meta.n.Bytes())
+		writeLengthPrefixed(h, meta.e.Bytes())
+		writeLengthPrefixed(h, idBytes[:])
+		writeLengthPrefixed(h, context)
+		for _, value := range []*big.Int{meta.v, meta.u, values.xTilde, values.vki, values.xi2, values.vPrime, values.xPrime} {
+			writeLengthPrefixed(h, value.Bytes())
+		}
+		return meta.proof.challenge(h.Sum(nil)), nil
+	default:
+		return nil, fmt.Errorf("unknown proof version %d", version)
+	}
+}
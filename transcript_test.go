@@ -0,0 +1,84 @@
+package tcrsa
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestSigShare_Verify_versions(t *testing.T) {
+	keyShares, keyMeta, err := NewKey(512, 2, 3, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	docHash := sha256.Sum256([]byte("share proof transcript"))
+	doc, err := PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, docHash[:])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	context := []byte("session 1")
+
+	legacy, err := keyShares[0].sign(doc, crypto.SHA256, keyMeta, ProofVersionLegacy, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := legacy.Verify(doc, keyMeta); err != nil {
+		t.Errorf("legacy proof should be accepted: %v", err)
+	}
+	if err := legacy.VerifyWithContext(doc, keyMeta, context); err == nil {
+		t.Errorf("legacy proof should not be accepted with a context")
+	}
+	if _, err := keyShares[0].sign(doc, crypto.SHA256, keyMeta, ProofVersionLegacy, context); err == nil {
+		t.Errorf("legacy proof should not be generated with a context")
+	}
+
+	sigShare, err := keyShares[0].Sign(doc, crypto.SHA256, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if sigShare.Version != ProofVersion1 {
+		t.Errorf("proof version should be %d, but it is %d", ProofVersion1, sigShare.Version)
+	}
+	if err := sigShare.Verify(doc, keyMeta); err != nil {
+		t.Errorf("%v", err)
+	}
+	if err := sigShare.VerifyWithContext(doc, keyMeta, context); err == nil {
+		t.Errorf("proof without a context should not be accepted with a context")
+	}
+
+	withContext, err := keyShares[1].SignWithContext(doc, crypto.SHA256, keyMeta, context)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := withContext.VerifyWithContext(doc, keyMeta, context); err != nil {
+		t.Errorf("%v", err)
+	}
+	for _, other := range [][]byte{nil, []byte("session 2")} {
+		if err := withContext.VerifyWithContext(doc, keyMeta, other); err == nil {
+			t.Errorf("proof should not be accepted with context %q", other)
+		}
+	}
+
+	// The version 1 proof is bound to the share Id and the version, so it cannot be downgraded
+	// or moved to another share.
+	downgraded := *sigShare
+	downgraded.Version = ProofVersionLegacy
+	if err := downgraded.Verify(doc, keyMeta); err == nil {
+		t.Errorf("proof with a changed version should not be accepted")
+	}
+	unknown := *sigShare
+	unknown.Version = 2
+	if err := unknown.Verify(doc, keyMeta); err == nil {
+		t.Errorf("proof with an unknown version should not be accepted")
+	}
+
+	// Shares with legacy and version 1 proofs can be joined together.
+	signature, err := SigShareList{legacy, withContext}.Join(doc, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, crypto.SHA256, docHash[:], signature); err != nil {
+		t.Errorf("%v", err)
+	}
+}
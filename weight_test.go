@@ -0,0 +1,90 @@
+package tcrsa_test
+
+import (
+	"crypto/rsa"
+	"github.com/niclabs/tcrsa"
+	"reflect"
+	"testing"
+)
+
+func TestWeights(t *testing.T) {
+	// The security office counts as two votes and each branch office as one: 5 shares, threshold 3.
+	args := fixedKeyArgs(t)
+	args.Participants = []string{"security", "branch-1", "branch-2", "branch-3"}
+	args.Weights = map[string]uint16{"security": 2}
+	keyShares, keyMeta, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := map[string]uint16{"security": 2, "branch-1": 1, "branch-2": 1, "branch-3": 1}
+	if weights := keyMeta.Weights(); !reflect.DeepEqual(weights, expected) {
+		t.Errorf("weights should be %v, but they are %v", expected, weights)
+	}
+	security := keyShares.Participant("security")
+	if len(security) != 2 {
+		t.Fatalf("security office should have 2 key shares, but it has %d", len(security))
+	}
+
+	docs, hashes := batchDocs(t, 1, keyMeta)
+	securitySigShares, err := security.Sign(docs[0], keyTestHashType, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	branchSigShares, err := keyShares.Participant("branch-2").Sign(docs[0], keyTestHashType, keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	sigShares := append(securitySigShares, branchSigShares...)
+	for _, sigShare := range sigShares {
+		if err := sigShare.Verify(docs[0], keyMeta); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+	signature, err := sigShares.Join(docs[0], keyMeta)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(keyMeta.PublicKey, keyTestHashType, hashes[0], signature); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	// The security office alone does not reach the threshold, and its shares cannot be counted twice.
+	if _, err := securitySigShares.Join(docs[0], keyMeta); err == nil {
+		t.Errorf("join should fail without enough weight")
+	}
+	if _, err := append(securitySigShares, securitySigShares[0]).Join(docs[0], keyMeta); err == nil {
+		t.Errorf("join should fail with repeated shares")
+	}
+
+	// The shares of a participant with several shares need their ids.
+	unnamed := *securitySigShares[1]
+	unnamed.Id = 0
+	if err := unnamed.Verify(docs[0], keyMeta); err == nil {
+		t.Errorf("signature share of a weighted participant without id should not be valid")
+	}
+	foreign := *securitySigShares[1]
+	foreign.Name = "branch-1"
+	if err := foreign.Verify(docs[0], keyMeta); err == nil {
+		t.Errorf("signature share with an id of other participant should not be valid")
+	}
+}
+
+func TestWeights_invalid(t *testing.T) {
+	for _, c := range []struct {
+		names   []string
+		weights map[string]uint16
+	}{
+		{[]string{"a", "b", "c", "d"}, map[string]uint16{"a": 3}},
+		{[]string{"a", "b", "c", "d"}, map[string]uint16{"a": 1}},
+		{[]string{"a", "b", "c", "d", "e"}, map[string]uint16{"a": 0}},
+		{[]string{"a", "b", "c", "d"}, map[string]uint16{"a": 2, "z": 1}},
+		{nil, map[string]uint16{"a": 2}},
+	} {
+		args := fixedKeyArgs(t)
+		args.Participants = c.names
+		args.Weights = c.weights
+		if _, _, err := tcrsa.NewKey(keyTestFixedSize, keyTestK, keyTestL, args); err == nil {
+			t.Errorf("participants %q with weights %v should not be accepted", c.names, c.weights)
+		}
+	}
+}